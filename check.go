@@ -0,0 +1,162 @@
+package errcheckstack
+
+import (
+	"context"
+	"go/token"
+	"sort"
+
+	"github.com/jhchabran/errcheckstack/internal/driver"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// Report holds the outcome of Check.
+type Report struct {
+	Findings []Finding `json:"findings"`
+	// Functions holds the wrapped status of every function of the module
+	// returning an error.
+	Functions []Function `json:"functions"`
+}
+
+// Finding is a diagnostic of the analyzer.
+type Finding struct {
+	Rule     Rule           `json:"rule"`
+	Severity Severity       `json:"severity"`
+	Message  string         `json:"message"`
+	Pos      token.Position `json:"pos"`
+	End      token.Position `json:"end"`
+	// Related holds the locations explaining the finding, such as the call
+	// path from an entrypoint.
+	Related []Related `json:"related,omitempty"`
+	Fixes   []Fix     `json:"fixes,omitempty"`
+}
+
+// Related is a location related to a finding.
+type Related struct {
+	Pos     token.Position `json:"pos"`
+	Message string         `json:"message"`
+}
+
+// Fix is a suggested fix of a finding.
+type Fix struct {
+	Message string `json:"message"`
+	Edits   []Edit `json:"edits"`
+}
+
+// Edit replaces the text between Pos and End with NewText.
+type Edit struct {
+	Pos     token.Position `json:"pos"`
+	End     token.Position `json:"end"`
+	NewText string         `json:"newText"`
+}
+
+// Function is the wrapped status of a function returning an error.
+type Function struct {
+	// Name is the full name of the function, such as (*example.com/a.T).Run.
+	Name    string         `json:"name"`
+	Package string         `json:"package"`
+	Pos     token.Position `json:"pos"`
+	// Status is either StatusWrapped, StatusNaked or StatusUnknown.
+	Status string `json:"status"`
+	// Reason explains why the function is naked.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Check analyzes the packages matching the patterns in dir, ./... by default,
+// and returns the findings along with the wrapped status of the functions of
+// the module. When entrypoints are enabled, only the findings reaching them
+// are returned.
+func Check(ctx context.Context, dir string, cfg Config, patterns ...string) (*Report, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	pkgs, err := driver.Load(ctx, dir, nil, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := driver.Run(ctx, newProgramAnalyzer(cfg), pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []analysis.Diagnostic
+	if cfg.Entrypoints.Enabled {
+		diags, err = reachingDiagnostics(pkgs, res, cfg.Entrypoints)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		roots := map[*packages.Package]bool{}
+		for _, pkg := range pkgs {
+			roots[pkg] = true
+		}
+		for _, p := range res.Packages {
+			if roots[p.Pkg] {
+				diags = append(diags, p.Diagnostics...)
+			}
+		}
+	}
+
+	report := &Report{Findings: []Finding{}, Functions: []Function{}}
+	for _, d := range diags {
+		report.Findings = append(report.Findings, newFinding(&cfg, res.Fset, d))
+	}
+	for _, p := range res.Packages {
+		r, ok := p.Result.(*Result)
+		if !ok {
+			continue
+		}
+		for fn, summary := range r.Funcs {
+			report.Functions = append(report.Functions, Function{
+				Name:    fn.FullName(),
+				Package: p.Pkg.PkgPath,
+				Pos:     res.Fset.Position(fn.Pos()),
+				Status:  summary.Status,
+				Reason:  summary.Reason,
+			})
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return positionLess(report.Findings[i].Pos, report.Findings[j].Pos)
+	})
+	sort.SliceStable(report.Functions, func(i, j int) bool {
+		return positionLess(report.Functions[i].Pos, report.Functions[j].Pos)
+	})
+	return report, nil
+}
+
+func newFinding(cfg *Config, fset *token.FileSet, d analysis.Diagnostic) Finding {
+	rule := Rule(d.Category)
+	f := Finding{
+		Rule:     rule,
+		Severity: cfg.RuleSeverity(rule),
+		Message:  d.Message,
+		Pos:      fset.Position(d.Pos),
+	}
+	if d.End.IsValid() {
+		f.End = fset.Position(d.End)
+	}
+	for _, r := range d.Related {
+		f.Related = append(f.Related, Related{Pos: fset.Position(r.Pos), Message: r.Message})
+	}
+	for _, sf := range d.SuggestedFixes {
+		fix := Fix{Message: sf.Message}
+		for _, e := range sf.TextEdits {
+			fix.Edits = append(fix.Edits, Edit{
+				Pos:     fset.Position(e.Pos),
+				End:     fset.Position(e.End),
+				NewText: string(e.NewText),
+			})
+		}
+		f.Fixes = append(f.Fixes, fix)
+	}
+	return f
+}
+
+func positionLess(a, b token.Position) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Offset < b.Offset
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+
+	"github.com/jhchabran/errcheckstack"
+	"github.com/jhchabran/errcheckstack/internal/driver"
+)
+
+// newCache returns the cache stored in dir. Its entries are salted with the
+// configuration and the executable itself, so that upgrading the analyzer
+// invalidates them.
+func newCache(dir string, cfg errcheckstack.Config) (*driver.Cache, error) {
+	fingerprint, err := cfg.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return &driver.Cache{Dir: dir, Salt: h.Sum(fingerprint)}, nil
+}
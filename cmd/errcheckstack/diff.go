@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// lineRange is a range of lines, from start to end included.
+type lineRange struct {
+	start, end int
+}
+
+// changes holds the lines added by a diff, by absolute filename.
+type changes map[string][]lineRange
+
+// contains returns whether pos is on an added line.
+func (c changes) contains(pos token.Position) bool {
+	for _, r := range c[pos.Filename] {
+		if pos.Line >= r.start && pos.Line <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the diagnostics on added lines.
+func (c changes) filter(fset *token.FileSet, diags []analysis.Diagnostic) []analysis.Diagnostic {
+	var kept []analysis.Diagnostic
+	for _, d := range diags {
+		if c.contains(fset.Position(d.Pos)) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// loadChanges returns the changes made since the git ref base, or the ones of
+// the patch file when base is empty. Paths are relative to the current
+// directory.
+func loadChanges(base, patch string) (changes, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		f, err := os.Open(patch)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseDiff(f, wd)
+	}
+
+	var stdout, stderr bytes.Buffer
+	// The prefixes are forced, as they can be changed or removed through the
+	// diff.noprefix and diff.mnemonicPrefix settings.
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "--relative", "--src-prefix=a/", "--dst-prefix=b/", base, "--")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git diff %s: %v: %s", base, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseDiff(&stdout, wd)
+}
+
+// parseDiff parses the unified diff read from r, with paths relative to root,
+// and returns the lines added to the new files, context lines excluded.
+func parseDiff(r io.Reader, root string) (changes, error) {
+	c := changes{}
+	var file string
+	// The lines left in the current hunk, on the old and new sides.
+	var old, new, line int
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		if old > 0 || new > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				c.add(file, line)
+				line++
+				new--
+			case strings.HasPrefix(text, "-"):
+				old--
+			case strings.HasPrefix(text, `\`):
+				// No newline at end of file.
+			default:
+				line++
+				old--
+				new--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			name := strings.TrimPrefix(text, "+++ ")
+			if i := strings.IndexByte(name, '\t'); i >= 0 {
+				name = name[:i]
+			}
+			if name == "/dev/null" {
+				// The file is deleted, no line is added to it.
+				file = ""
+				continue
+			}
+			file = filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(name, "b/")))
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			line, old, new, err = parseHunk(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		}
+	}
+	return c, scanner.Err()
+}
+
+// add adds a line to the changes of file, extending the last range when
+// possible.
+func (c changes) add(file string, line int) {
+	if file == "" {
+		return
+	}
+	ranges := c[file]
+	if n := len(ranges); n > 0 && ranges[n-1].end == line-1 {
+		ranges[n-1].end = line
+		return
+	}
+	c[file] = append(ranges, lineRange{start: line, end: line})
+}
+
+// parseHunk parses a hunk header, such as "@@ -1,4 +1,6 @@ func main() {",
+// and returns the first line of the new side and the line counts of both
+// sides.
+func parseHunk(header string) (start, old, new int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	_, old, err = parseHunkRange(fields[1][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	start, new, err = parseHunkRange(fields[2][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	return start, old, new, nil
+}
+
+// parseHunkRange parses a range of a hunk header, such as "1,4", where the
+// count defaults to 1.
+func parseHunkRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		count, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, count, err
+}
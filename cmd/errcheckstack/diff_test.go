@@ -0,0 +1,116 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/analysis"
+)
+
+const testDiff = `diff --git a/main.go b/main.go
+index 3b18e51..a9c7e2f 100644
+--- a/main.go
++++ b/main.go
+@@ -3,0 +4,2 @@ import "strconv"
++func a() error {
++}
+@@ -8,3 +10,5 @@ func b() error {
+ 	_, err := strconv.Atoi("x")
+-	return nil
++	// Returning the error.
++	return err
+ }
++++ added
+\ No newline at end of file
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package main
+diff --git a/pkg/new.go b/pkg/new.go
+new file mode 100644
+--- /dev/null
++++ b/pkg/new.go
+@@ -0,0 +1,3 @@
++package pkg
++
++func c() {}
+`
+
+func TestParseDiff(t *testing.T) {
+	c, err := parseDiff(strings.NewReader(testDiff), "/src/app")
+	assert.NoError(t, err)
+	assert.Equal(t, changes{
+		"/src/app/main.go":    {{start: 4, end: 5}, {start: 11, end: 12}, {start: 14, end: 14}},
+		"/src/app/pkg/new.go": {{start: 1, end: 3}},
+	}, c)
+
+	_, err = parseDiff(strings.NewReader("+++ b/main.go\n@@ -1 +x @@\n"), "/src/app")
+	assert.EqualError(t, err, `line 2: invalid hunk header "@@ -1 +x @@"`)
+}
+
+func TestChangesFilter(t *testing.T) {
+	fset := token.NewFileSet()
+	f := fset.AddFile("/src/app/main.go", -1, 100)
+	f.SetLines([]int{0, 10, 20, 30, 40, 50})
+	other := fset.AddFile("/src/app/other.go", -1, 100)
+	other.SetLines([]int{0, 10})
+
+	c := changes{"/src/app/main.go": {{start: 2, end: 3}}}
+	diags := []analysis.Diagnostic{
+		{Pos: f.Pos(5), Message: "line 1"},
+		{Pos: f.Pos(12), Message: "line 2"},
+		{Pos: f.Pos(35), Message: "line 4"},
+		{Pos: other.Pos(12), Message: "other file"},
+	}
+	assert.Equal(t, []analysis.Diagnostic{diags[1]}, c.filter(fset, diags))
+}
+
+func TestLoadChangesPrefixes(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	write := func(name, content string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	git("init", "-q")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	write("main.go", "package main\n")
+	write("b/b.go", "package b\n")
+	write("old.go", "package main\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("b/b.go", "package b\n\nfunc B() {}\n")
+	assert.NoError(t, os.Remove(filepath.Join(dir, "old.go")))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	// Whatever the prefixes configured, the paths are the ones of the files.
+	for _, setting := range []string{"diff.noprefix", "diff.mnemonicPrefix"} {
+		git("config", setting, "true")
+		c, err := loadChanges("HEAD", "")
+		assert.NoError(t, err)
+		assert.Equal(t, changes{
+			filepath.Join(dir, "main.go"):   {{start: 2, end: 3}},
+			filepath.Join(dir, "b", "b.go"): {{start: 2, end: 3}},
+		}, c, setting)
+		git("config", "--unset", setting)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jhchabran/errcheckstack"
+)
+
+// runGraph writes the error propagation graph of the packages matching the
+// patterns, instead of their diagnostics.
+func runGraph(cfg errcheckstack.Config) int {
+	format := flag.String("graph", "", "write the error propagation graph, as dot or json")
+	pkg := flag.String("graph-pkg", "", "only include the functions of the given package in the graph")
+	fn := flag.String("graph-func", "", "only include the paths going through the given function in the graph, such as (*example.com/a.T).Run")
+	flag.Parse()
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	g, err := errcheckstack.ErrorGraph(".", cfg, patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	if *pkg != "" {
+		g = g.FilterPackage(*pkg)
+	}
+	if *fn != "" {
+		g = g.FilterFunc(*fn)
+	}
+
+	switch *format {
+	case "dot":
+		err = writeDOT(os.Stdout, g)
+	case "json":
+		err = writeGraphJSON(os.Stdout, g)
+	default:
+		err = fmt.Errorf("unknown graph format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeDOT writes the graph in the Graphviz DOT language, with naked functions
+// and the edges they return naked errors through in red.
+func writeDOT(w io.Writer, g *errcheckstack.Graph) error {
+	fmt.Fprintln(w, "digraph errcheckstack {")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, n := range g.Nodes {
+		color := "black"
+		switch n.Status {
+		case errcheckstack.StatusWrapped:
+			color = "darkgreen"
+		case errcheckstack.StatusNaked:
+			color = "red"
+		}
+		fmt.Fprintf(w, "\t%q [label=%q, color=%s];\n", n.ID, n.ID+"\n"+n.Status, color)
+	}
+	for _, e := range g.Edges {
+		attrs := "color=darkgreen"
+		if !e.Wrapped {
+			attrs = "color=red, penwidth=2"
+		}
+		fmt.Fprintf(w, "\t%q -> %q [%s];\n", e.From, e.To, attrs)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+type jsonGraphNode struct {
+	Package string          `json:"package"`
+	Status  string          `json:"status"`
+	Sources []jsonGraphEdge `json:"sources"`
+}
+
+type jsonGraphEdge struct {
+	To      string `json:"to"`
+	Wrapped bool   `json:"wrapped"`
+}
+
+// writeGraphJSON writes the graph as an adjacency list, mapping each function
+// to the callees its errors come from.
+func writeGraphJSON(w io.Writer, g *errcheckstack.Graph) error {
+	adj := map[string]*jsonGraphNode{}
+	for _, n := range g.Nodes {
+		adj[n.ID] = &jsonGraphNode{Package: n.Package, Status: n.Status, Sources: []jsonGraphEdge{}}
+	}
+	for _, e := range g.Edges {
+		if n, ok := adj[e.From]; ok {
+			n.Sources = append(n.Sources, jsonGraphEdge{To: e.To, Wrapped: e.Wrapped})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(adj)
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go/token"
 	"os"
+	"strings"
 
 	"github.com/jhchabran/errcheckstack"
+	"github.com/jhchabran/errcheckstack/internal/driver"
+	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/singlechecker"
+	"golang.org/x/tools/go/packages"
 	"gopkg.in/yaml.v3"
 )
 
+const formatUsage = "output format, text or sarif"
+
 func main() {
 	b, err := os.ReadFile("config.yml")
 	if err != nil {
@@ -19,6 +28,162 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println(cfg)
+
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		os.Exit(runStats(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "suggest-config" {
+		os.Exit(runSuggestConfig(cfg, os.Args[2:]))
+	}
+
+	if flagValue(os.Args[1:], "graph", "") != "" {
+		os.Exit(runGraph(cfg))
+	}
+
+	// Reachability requires analyzing the whole program at once, and so do
+	// writing a single SARIF log, filtering the diagnostics of a diff and
+	// caching, which the singlechecker doesn't do. It also fails on any
+	// diagnostic, whatever the severity of its rule.
+	diff := flagValue(os.Args[1:], "diff-base", "") != "" || flagValue(os.Args[1:], "diff-file", "") != ""
+	cached := flagValue(os.Args[1:], "cache", "") != ""
+	if cfg.Entrypoints.Enabled || flagValue(os.Args[1:], "format", "text") == "sarif" || diff || cached || cfg.HasSeverities() {
+		os.Exit(runProgram(cfg))
+	}
+	// Accept the flag in text mode as well.
+	flag.String("format", "text", formatUsage)
 	singlechecker.Main(errcheckstack.NewAnalyzer(cfg))
 }
+
+// flagValue returns the value of a flag, such as -format, which has to be known
+// before choosing how to run the analyzer, hence before parsing the flags.
+func flagValue(args []string, flag string, def string) string {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if v := strings.TrimPrefix(name, flag+"="); v != name {
+			return v
+		}
+		if name == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return def
+}
+
+// runProgram analyzes the whole program at once, prints the diagnostics in the
+// requested format and returns the exit code. Like the singlechecker, it exits
+// with 3 when diagnostics were found, unless their severity is lower than
+// error. With a diff, only the diagnostics within its hunks are printed, while
+// the whole program is still analyzed for callees to keep their status.
+func runProgram(cfg errcheckstack.Config) int {
+	format := flag.String("format", "text", formatUsage)
+	diffBase := flag.String("diff-base", "", "only report the diagnostics in the lines changed since the given git ref")
+	diffFile := flag.String("diff-file", "", "only report the diagnostics in the lines changed by the given unified diff")
+	cacheDir := flag.String("cache", "", "cache the analysis of unchanged packages in the given directory, unless entrypoints are enabled")
+	flag.Parse()
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	var diff changes
+	if *diffBase != "" || *diffFile != "" {
+		if *diffBase != "" && *diffFile != "" {
+			fmt.Fprintln(os.Stderr, "errcheckstack: -diff-base and -diff-file are mutually exclusive")
+			return 1
+		}
+		var err error
+		diff, err = loadChanges(*diffBase, *diffFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+			return 1
+		}
+	}
+
+	var cache *driver.Cache
+	if *cacheDir != "" {
+		var err error
+		cache, err = newCache(*cacheDir, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+			return 1
+		}
+	}
+
+	fset, diags, err := analyze(cfg, cache, patterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	if diff != nil {
+		diags = diff.filter(fset, diags)
+	}
+
+	switch *format {
+	case "sarif":
+		wd, err := os.Getwd()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+			return 1
+		}
+		if err := writeSARIF(os.Stdout, &cfg, fset, wd, diags); err != nil {
+			fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+			return 1
+		}
+	case "text":
+		for _, d := range diags {
+			fmt.Fprintf(os.Stderr, "%s: %s [%s]\n", fset.Position(d.Pos), d.Message, d.Category)
+			for _, r := range d.Related {
+				fmt.Fprintf(os.Stderr, "\t%s: %s\n", fset.Position(r.Pos), r.Message)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "errcheckstack: unknown format %q\n", *format)
+		return 1
+	}
+
+	// Only the diagnostics of rules with the error severity fail the run.
+	for _, d := range diags {
+		if cfg.RuleSeverity(errcheckstack.Rule(d.Category)) == errcheckstack.SeverityError {
+			return 3
+		}
+	}
+	return 0
+}
+
+// analyze returns the diagnostics of the packages matching the patterns, or
+// only the ones reaching the entrypoints when enabled. The cache, if any, is
+// only used without entrypoints.
+func analyze(cfg errcheckstack.Config, cache *driver.Cache, patterns []string) (*token.FileSet, []analysis.Diagnostic, error) {
+	if cfg.Entrypoints.Enabled {
+		return errcheckstack.Entrypoints(".", cfg, patterns...)
+	}
+
+	pkgs, err := driver.Load(context.Background(), ".", nil, patterns...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var res *driver.Result
+	if cache != nil {
+		res, err = cache.Run(context.Background(), errcheckstack.NewAnalyzer(cfg), pkgs)
+	} else {
+		res, err = driver.Run(context.Background(), errcheckstack.NewAnalyzer(cfg), pkgs)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := map[*packages.Package]bool{}
+	for _, pkg := range pkgs {
+		roots[pkg] = true
+	}
+	var diags []analysis.Diagnostic
+	for _, p := range res.Packages {
+		if roots[p.Pkg] {
+			diags = append(diags, p.Diagnostics...)
+		}
+	}
+	return res.Fset, diags, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"go/token"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhchabran/errcheckstack"
+	"golang.org/x/tools/go/analysis"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolURI      = "https://github.com/jhchabran/errcheckstack"
+)
+
+// The types below model the subset of SARIF 2.1.0 errcheckstack produces.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Enabled bool   `json:"enabled"`
+	Level   string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+// writeSARIF writes the diagnostics as a SARIF log, with levels following the
+// severity of their rule. File paths are made relative to root when they're
+// inside it.
+func writeSARIF(w io.Writer, cfg *errcheckstack.Config, fset *token.FileSet, root string, diags []analysis.Diagnostic) error {
+	s := &sarifWriter{fset: fset, root: root}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "errcheckstack",
+			InformationURI: toolURI,
+		}},
+		Results: []sarifResult{},
+	}
+	for _, r := range errcheckstack.Rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               string(r.ID),
+			ShortDescription: sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{
+				Enabled: cfg.RuleEnabled(r.ID),
+				Level:   sarifLevel(cfg.RuleSeverity(r.ID)),
+			},
+		})
+	}
+
+	for _, d := range diags {
+		res := sarifResult{
+			RuleID:    d.Category,
+			Level:     sarifLevel(cfg.RuleSeverity(errcheckstack.Rule(d.Category))),
+			Message:   sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{s.location(d.Pos, d.End)},
+		}
+		for i, r := range d.Related {
+			id := i + 1
+			loc := s.location(r.Pos, r.End)
+			loc.ID = &id
+			loc.Message = &sarifMessage{Text: r.Message}
+			res.RelatedLocations = append(res.RelatedLocations, loc)
+		}
+		for _, f := range d.SuggestedFixes {
+			res.Fixes = append(res.Fixes, s.fix(f))
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	})
+}
+
+// sarifLevel returns the SARIF level matching a severity.
+func sarifLevel(s errcheckstack.Severity) string {
+	switch s {
+	case errcheckstack.SeverityWarning:
+		return "warning"
+	case errcheckstack.SeverityInfo:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+type sarifWriter struct {
+	fset *token.FileSet
+	root string
+}
+
+func (s *sarifWriter) location(pos, end token.Pos) sarifLocation {
+	start := s.fset.Position(pos)
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: s.uri(start.Filename)},
+		Region:           s.region(pos, end),
+	}}
+}
+
+func (s *sarifWriter) region(pos, end token.Pos) sarifRegion {
+	start := s.fset.Position(pos)
+	r := sarifRegion{StartLine: start.Line, StartColumn: start.Column}
+	if end.IsValid() {
+		stop := s.fset.Position(end)
+		r.EndLine, r.EndColumn = stop.Line, stop.Column
+	}
+	return r
+}
+
+// fix converts a suggested fix, grouping its edits by file.
+func (s *sarifWriter) fix(f analysis.SuggestedFix) sarifFix {
+	fix := sarifFix{Description: sarifMessage{Text: f.Message}}
+	changes := map[string]int{}
+	for _, edit := range f.TextEdits {
+		uri := s.uri(s.fset.Position(edit.Pos).Filename)
+		i, ok := changes[uri]
+		if !ok {
+			i = len(fix.ArtifactChanges)
+			changes[uri] = i
+			fix.ArtifactChanges = append(fix.ArtifactChanges, sarifArtifactChange{
+				ArtifactLocation: sarifArtifactLocation{URI: uri},
+			})
+		}
+		fix.ArtifactChanges[i].Replacements = append(fix.ArtifactChanges[i].Replacements, sarifReplacement{
+			DeletedRegion:   s.region(edit.Pos, edit.End),
+			InsertedContent: sarifMessage{Text: string(edit.NewText)},
+		})
+	}
+	return fix
+}
+
+// uri returns the path relative to the root for files inside it, and a file
+// URI otherwise.
+func (s *sarifWriter) uri(filename string) string {
+	if rel, err := filepath.Rel(s.root, filename); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
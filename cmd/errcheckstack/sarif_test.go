@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhchabran/errcheckstack"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/analysis"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	fset := token.NewFileSet()
+	f := fset.AddFile("/src/app/main.go", -1, 100)
+	f.SetLines([]int{0, 20, 40, 60})
+	dep := fset.AddFile("/other/dep.go", -1, 50)
+	dep.SetLines([]int{0, 10})
+
+	diags := []analysis.Diagnostic{{
+		Pos:      f.Pos(22),
+		End:      f.Pos(30),
+		Category: "redundant-wrap",
+		Message:  "error passed to WithStack is already wrapped",
+		Related: []analysis.RelatedInformation{
+			{Pos: dep.Pos(12), Message: "entrypoint main.main"},
+		},
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message:   "Remove the wrapper",
+			TextEdits: []analysis.TextEdit{{Pos: f.Pos(22), End: f.Pos(30), NewText: []byte("err")}},
+		}},
+	}}
+
+	var buf bytes.Buffer
+	cfg := &errcheckstack.Config{Rules: map[errcheckstack.Rule]errcheckstack.RuleConfig{
+		errcheckstack.RuleRedundantWrap: {Severity: errcheckstack.SeverityWarning},
+	}}
+	err := writeSARIF(&buf, cfg, fset, "/src/app", diags)
+	assert.NoError(t, err)
+
+	var log sarifLog
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Len(t, log.Runs, 1)
+	assert.NotEmpty(t, log.Runs[0].Tool.Driver.Rules)
+
+	res := log.Runs[0].Results
+	assert.Len(t, res, 1)
+	assert.Equal(t, "redundant-wrap", res[0].RuleID)
+	assert.Equal(t, "warning", res[0].Level)
+	assert.Equal(t, sarifArtifactLocation{URI: "main.go"}, res[0].Locations[0].PhysicalLocation.ArtifactLocation)
+	assert.Equal(t, sarifRegion{StartLine: 2, StartColumn: 3, EndLine: 2, EndColumn: 11}, res[0].Locations[0].PhysicalLocation.Region)
+	assert.Equal(t, "file:///other/dep.go", res[0].RelatedLocations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "entrypoint main.main", res[0].RelatedLocations[0].Message.Text)
+	assert.Equal(t, "err", res[0].Fixes[0].ArtifactChanges[0].Replacements[0].InsertedContent.Text)
+}
+
+func TestWriteSARIFErrorChain(t *testing.T) {
+	p, err := filepath.Abs("../../testdata")
+	assert.NoError(t, err)
+	t.Setenv("GOPATH", p)
+	t.Setenv("GO111MODULE", "off")
+	t.Setenv("GOPROXY", "off")
+
+	tests := []struct {
+		module  string
+		related []string
+	}{
+		// The error is returned away from the call producing it.
+		{"simple_no_wrap", []string{"main.go:12: error returned by encoding/json.Marshal"}},
+		// The error is loaded from a field holding a naked error.
+		{"fields", []string{"main.go:32: naked error stored in field s.lastErr"}},
+		// The errors are returned by the functions passed to errgroup.Group.Go
+		// or received from a channel.
+		{"concurrency", []string{
+			"main.go:33: naked error returned to errgroup.Group.Go",
+			"main.go:51: error received from channel errCh",
+			"main.go:58: error returned by strconv.Atoi",
+			"main.go:72: error returned by (*golang.org/x/sync/errgroup.Group).Wait",
+			"main.go:70: naked error returned to errgroup.Group.Go",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			wd, err := os.Getwd()
+			assert.NoError(t, err)
+			dir := filepath.Join(p, "src", tt.module)
+			assert.NoError(t, os.Chdir(dir))
+			defer os.Chdir(wd)
+
+			cfg := errcheckstack.Config{
+				WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+				ModuleName:         tt.module,
+			}
+			fset, diags, err := analyze(cfg, nil, []string{tt.module})
+			assert.NoError(t, err)
+
+			var buf bytes.Buffer
+			assert.NoError(t, writeSARIF(&buf, &cfg, fset, dir, diags))
+			var log sarifLog
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+
+			var related []string
+			for _, res := range log.Runs[0].Results {
+				for _, loc := range res.RelatedLocations {
+					related = append(related, fmt.Sprintf("%s:%d: %s", loc.PhysicalLocation.ArtifactLocation.URI, loc.PhysicalLocation.Region.StartLine, loc.Message.Text))
+				}
+			}
+			assert.Equal(t, tt.related, related)
+		})
+	}
+}
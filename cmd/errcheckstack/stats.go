@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jhchabran/errcheckstack"
+)
+
+// runStats implements the stats command, printing how many functions are
+// wrapped, naked or unknown per package and for the whole module.
+func runStats(cfg errcheckstack.Config, args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	format := fs.String("format", "table", "output format, table, json or csv")
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	stats, err := errcheckstack.ComputeStats(".", cfg, patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+
+	switch *format {
+	case "table":
+		err = writeStatsTable(os.Stdout, stats)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(stats)
+	case "csv":
+		err = writeStatsCSV(os.Stdout, stats)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeStatsTable(w io.Writer, stats *errcheckstack.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tTOTAL\tWRAPPED\tNAKED\tUNKNOWN\tCOVERAGE")
+	row := func(name string, c errcheckstack.Counts) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", name, c.Total, c.Wrapped, c.Naked, c.Unknown, coverage(c))
+	}
+	for _, p := range stats.Packages {
+		row(p.Path, p.Counts)
+	}
+	row("(module)", stats.Module)
+
+	if len(stats.NakedCallees) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "EXTERNAL CALLEE\tNAKED FUNCTIONS")
+		for _, c := range stats.NakedCallees {
+			fmt.Fprintf(tw, "%s\t%d\n", c.Callee, c.NakedFunctions)
+		}
+	}
+	return tw.Flush()
+}
+
+// writeStatsCSV writes one record per package, followed by the module totals
+// with an empty package path.
+func writeStatsCSV(w io.Writer, stats *errcheckstack.Stats) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"package", "total", "wrapped", "naked", "unknown"})
+	record := func(name string, c errcheckstack.Counts) {
+		cw.Write([]string{name, strconv.Itoa(c.Total), strconv.Itoa(c.Wrapped), strconv.Itoa(c.Naked), strconv.Itoa(c.Unknown)})
+	}
+	for _, p := range stats.Packages {
+		record(p.Path, p.Counts)
+	}
+	record("", stats.Module)
+	cw.Flush()
+	return cw.Error()
+}
+
+// coverage returns the percentage of wrapped functions.
+func coverage(c errcheckstack.Counts) string {
+	if c.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(c.Wrapped)/float64(c.Total))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jhchabran/errcheckstack"
+)
+
+// runSuggestConfig implements the suggest-config command, printing the
+// wrapping signatures of config.yml along with the wrappers inferred in the
+// module, for them to be reviewed before being added to the configuration.
+func runSuggestConfig(cfg errcheckstack.Config, args []string) int {
+	fs := flag.NewFlagSet("suggest-config", flag.ExitOnError)
+	fs.Parse(args)
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	wrappers, err := errcheckstack.InferWrappers(".", cfg, patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "errcheckstack: %v\n", err)
+		return 1
+	}
+	writeSuggestedConfig(os.Stdout, cfg, wd, wrappers)
+	return 0
+}
+
+// writeSuggestedConfig writes the wrappingSignatures section of config.yml,
+// with the inferred wrappers commented with their location relative to root.
+func writeSuggestedConfig(w io.Writer, cfg errcheckstack.Config, root string, wrappers []errcheckstack.InferredWrapper) {
+	fmt.Fprintln(w, "wrappingSignatures:")
+	known := map[string]bool{}
+	for _, sig := range cfg.WrappingSignatures {
+		known[sig] = true
+		fmt.Fprintf(w, "  - %s\n", sig)
+	}
+	for _, wr := range wrappers {
+		if known[wr.Name] {
+			continue
+		}
+		filename := wr.Pos.Filename
+		if rel, err := filepath.Rel(root, filename); err == nil {
+			filename = rel
+		}
+		fmt.Fprintf(w, "  - %q # inferred from %s:%d\n", wr.Name, filename, wr.Pos.Line)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"go/token"
+	"testing"
+
+	"github.com/jhchabran/errcheckstack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSuggestedConfig(t *testing.T) {
+	cfg := errcheckstack.Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack", "example.com/app/errs.Wrap"},
+	}
+	wrappers := []errcheckstack.InferredWrapper{
+		{Name: "example.com/app/errs.Wrap", Pos: token.Position{Filename: "/src/app/errs/errs.go", Line: 3}},
+		{Name: "(*example.com/app.T).wrap", Pos: token.Position{Filename: "/src/app/t.go", Line: 12}},
+	}
+
+	var buf bytes.Buffer
+	writeSuggestedConfig(&buf, cfg, "/src/app", wrappers)
+	assert.Equal(t, `wrappingSignatures:
+  - github.com/cockroachdb/errors.WithStack
+  - example.com/app/errs.Wrap
+  - "(*example.com/app.T).wrap" # inferred from t.go:12
+`, buf.String())
+}
@@ -0,0 +1,183 @@
+package errcheckstack
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// checkComparison reports type assertions, type switches and == comparisons
+// applied to errors that may come from a wrapped source. Once wrapped, such
+// errors no longer match, and errors.As or errors.Is must be used instead.
+func checkComparison(cfg *Config, pass *analysis.Pass, file *ast.File, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.TypeAssertExpr:
+		if !isError(pass.TypesInfo.TypeOf(n.X)) || !mayBeWrapped(cfg, pass, n.X) {
+			return
+		}
+		if n.Type == nil {
+			reportf(cfg, pass, RuleTypeAssertion, n.Pos(), "type switch on error %s may fail on wrapped errors, use errors.As", types.ExprString(n.X))
+			return
+		}
+		report(cfg, pass, RuleTypeAssertion, analysis.Diagnostic{
+			Pos:            n.Pos(),
+			End:            n.End(),
+			Message:        fmt.Sprintf("type assertion on error %s may fail on wrapped errors, use errors.As", types.ExprString(n.X)),
+			SuggestedFixes: typeAssertFix(pass, file, n),
+		})
+
+	case *ast.BinaryExpr:
+		if n.Op != token.EQL && n.Op != token.NEQ {
+			return
+		}
+		x, y := astutil.Unparen(n.X), astutil.Unparen(n.Y)
+		if pass.TypesInfo.Types[x].IsNil() || pass.TypesInfo.Types[y].IsNil() {
+			return
+		}
+		if !isError(pass.TypesInfo.TypeOf(x)) && !isError(pass.TypesInfo.TypeOf(y)) {
+			return
+		}
+		errExpr, target, ok := comparedError(cfg, pass, x, y)
+		if !ok {
+			return
+		}
+		report(cfg, pass, RuleComparison, analysis.Diagnostic{
+			Pos:            n.Pos(),
+			End:            n.End(),
+			Message:        fmt.Sprintf("comparison of error %s with %s may fail on wrapped errors, use errors.Is", types.ExprString(errExpr), n.Op),
+			SuggestedFixes: comparisonFix(pass, file, n, errExpr, target),
+		})
+	}
+}
+
+// comparedError returns which of the operands of a comparison is the error that
+// may be wrapped, and which one is the target it's compared to, such as a
+// sentinel. When both may be wrapped, package level variables are taken as
+// the target.
+func comparedError(cfg *Config, pass *analysis.Pass, x, y ast.Expr) (errExpr, target ast.Expr, ok bool) {
+	xWrapped, yWrapped := mayBeWrapped(cfg, pass, x), mayBeWrapped(cfg, pass, y)
+	switch {
+	case xWrapped && yWrapped:
+		if isPackageVar(pass, x) && !isPackageVar(pass, y) {
+			return y, x, true
+		}
+		return x, y, true
+	case xWrapped:
+		return x, y, true
+	case yWrapped:
+		return y, x, true
+	}
+	return nil, nil, false
+}
+
+// isPackageVar returns whether expr designates a package level variable.
+func isPackageVar(pass *analysis.Pass, expr ast.Expr) bool {
+	var ident *ast.Ident
+	switch e := expr.(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return false
+	}
+	v, ok := pass.TypesInfo.ObjectOf(ident).(*types.Var)
+	return ok && v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
+
+// comparisonFix rewrites `err == target` into `errors.Is(err, target)`, errExpr
+// being the operand holding the error that may be wrapped, without its
+// parentheses.
+func comparisonFix(pass *analysis.Pass, file *ast.File, bin *ast.BinaryExpr, errExpr, target ast.Expr) []analysis.SuggestedFix {
+	pkg, ok := errorsPkgName(pass, file)
+	if !ok {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if bin.Op == token.NEQ {
+		buf.WriteString("!")
+	}
+	fmt.Fprintf(&buf, "%s.Is(", pkg)
+	if err := format.Node(&buf, pass.Fset, errExpr); err != nil {
+		return nil
+	}
+	buf.WriteString(", ")
+	if err := format.Node(&buf, pass.Fset, target); err != nil {
+		return nil
+	}
+	buf.WriteString(")")
+
+	return []analysis.SuggestedFix{{
+		Message:   fmt.Sprintf("Use %s.Is", pkg),
+		TextEdits: []analysis.TextEdit{{Pos: bin.Pos(), End: bin.End(), NewText: buf.Bytes()}},
+	}}
+}
+
+// typeAssertFix rewrites `_, ok := err.(T)` into `ok := errors.As(err, new(T))`.
+// Other forms of type assertions need to declare a variable of type T first,
+// which can't be done in place.
+func typeAssertFix(pass *analysis.Pass, file *ast.File, ta *ast.TypeAssertExpr) []analysis.SuggestedFix {
+	path, _ := astutil.PathEnclosingInterval(file, ta.Pos(), ta.End())
+	if len(path) < 2 {
+		return nil
+	}
+	ass, ok := path[1].(*ast.AssignStmt)
+	if !ok || len(ass.Lhs) != 2 || len(ass.Rhs) != 1 || ass.Rhs[0] != ta {
+		return nil
+	}
+	if blank, ok := ass.Lhs[0].(*ast.Ident); !ok || blank.Name != "_" {
+		return nil
+	}
+	pkg, ok := errorsPkgName(pass, file)
+	if !ok {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, pass.Fset, ass.Lhs[1]); err != nil {
+		return nil
+	}
+	fmt.Fprintf(&buf, " %s %s.As(", ass.Tok, pkg)
+	if err := format.Node(&buf, pass.Fset, ta.X); err != nil {
+		return nil
+	}
+	buf.WriteString(", new(")
+	if err := format.Node(&buf, pass.Fset, ta.Type); err != nil {
+		return nil
+	}
+	buf.WriteString("))")
+
+	return []analysis.SuggestedFix{{
+		Message:   fmt.Sprintf("Use %s.As", pkg),
+		TextEdits: []analysis.TextEdit{{Pos: ass.Pos(), End: ass.End(), NewText: buf.Bytes()}},
+	}}
+}
+
+// errorsPkgName returns the name under which the file imports a package
+// providing both Is and As, such as the standard errors package.
+func errorsPkgName(pass *analysis.Pass, file *ast.File) (string, bool) {
+	for _, imp := range file.Imports {
+		var obj types.Object
+		if imp.Name != nil {
+			obj = pass.TypesInfo.Defs[imp.Name]
+		} else {
+			obj = pass.TypesInfo.Implicits[imp]
+		}
+		pkgName, ok := obj.(*types.PkgName)
+		if !ok {
+			continue
+		}
+		scope := pkgName.Imported().Scope()
+		if scope.Lookup("Is") != nil && scope.Lookup("As") != nil {
+			return pkgName.Name(), true
+		}
+	}
+	return "", false
+}
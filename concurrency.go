@@ -0,0 +1,243 @@
+package errcheckstack
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const (
+	errgroupGo   = "(*golang.org/x/sync/errgroup.Group).Go"
+	errgroupWait = "(*golang.org/x/sync/errgroup.Group).Wait"
+)
+
+// enclosingFuncLit returns the function literal that is the innermost
+// function enclosing the last node of the stack, if any.
+func enclosingFuncLit(stack []ast.Node) *ast.FuncLit {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.FuncLit:
+			return n
+		case *ast.FuncDecl:
+			return nil
+		}
+	}
+	return nil
+}
+
+// isReceive returns the receive operation expr is made of, if any.
+func isReceive(expr ast.Expr) (*ast.UnaryExpr, bool) {
+	recv, ok := astutil.Unparen(expr).(*ast.UnaryExpr)
+	if !ok || recv.Op != token.ARROW {
+		return nil, false
+	}
+	return recv, true
+}
+
+// chanWrapped returns whether the errors received from a channel are wrapped,
+// which is the case when all the errors sent on it within the package are.
+//
+// Channels are identified by the variable or field holding them, so a channel
+// without any send in the package, such as one given by another package, is
+// considered to be naked.
+func chanWrapped(cfg *Config, pass *analysis.Pass, recv *ast.UnaryExpr) bool {
+	ch := varOf(pass, recv.X)
+	if ch == nil {
+		return false
+	}
+
+	sends := pass.ResultOf[syncAnalyzer].(*syncIndex).sent(ch)
+	for _, value := range sends {
+		if !returnedWrapped(cfg, pass, value) {
+			return false
+		}
+	}
+	return len(sends) > 0
+}
+
+// groupWaitWrapped returns whether call is a call to errgroup.Group.Wait, and
+// if so whether the error it returns is wrapped, which is the case when all
+// the functions passed to Go on the same group return wrapped errors.
+func groupWaitWrapped(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) (wrapped bool, isWait bool) {
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil || fn.FullName() != errgroupWait {
+		return false, false
+	}
+	return len(groupNakedFuncs(cfg, pass, call)) == 0, true
+}
+
+// groupNakedFuncs returns the positions of the naked errors returned by the
+// functions passed to Go on the group waited for by call, a call to
+// errgroup.Group.Wait: the naked returns of function literals, and other
+// function values as a whole. A group that can't be identified is naked as a
+// whole.
+func groupNakedFuncs(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) []ast.Node {
+	group := varOf(pass, call.Fun.(*ast.SelectorExpr).X)
+	if group == nil {
+		return []ast.Node{call}
+	}
+
+	var naked []ast.Node
+	for _, f := range pass.ResultOf[syncAnalyzer].(*syncIndex).started(group) {
+		if lit, ok := astutil.Unparen(f).(*ast.FuncLit); ok {
+			for _, res := range nakedReturns(cfg, pass, lit) {
+				naked = append(naked, res)
+			}
+			continue
+		}
+		if !funcValueWrapped(cfg, pass, f) {
+			naked = append(naked, f)
+		}
+	}
+	return naked
+}
+
+// startedOnReportedGroup returns whether lit is passed to errgroup.Group.Go on
+// a group whose naked errors are reported where it is waited for.
+func startedOnReportedGroup(cfg *Config, pass *analysis.Pass, lit *ast.FuncLit) bool {
+	syncs := pass.ResultOf[syncAnalyzer].(*syncIndex)
+	group, ok := syncs.startedOn(lit)
+	if !ok || group == nil {
+		return false
+	}
+	if flows, ok := syncs.flows[group]; ok {
+		return flows
+	}
+	flows := false
+	for _, w := range syncs.waited(group) {
+		if waitFlows(cfg, pass, w) {
+			flows = true
+			break
+		}
+	}
+	syncs.flows[group] = flows
+	return flows
+}
+
+// waitFlows returns whether the error returned by a call to
+// errgroup.Group.Wait is returned or passed to a sink, either directly or
+// through the variable it is assigned to.
+func waitFlows(cfg *Config, pass *analysis.Pass, w waitCall) bool {
+	var lhs ast.Expr
+	switch p := w.parent.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.CallExpr:
+		return isSinkArg(cfg, pass, p, w.call)
+	case *ast.AssignStmt:
+		for i, rhs := range p.Rhs {
+			if astutil.Unparen(rhs) == w.call && len(p.Lhs) == len(p.Rhs) {
+				lhs = p.Lhs[i]
+			}
+		}
+	case *ast.ValueSpec:
+		for i, value := range p.Values {
+			if astutil.Unparen(value) == w.call && len(p.Names) == len(p.Values) {
+				lhs = p.Names[i]
+			}
+		}
+	}
+	v := varOf(pass, lhs)
+	if v == nil || w.body == nil {
+		return false
+	}
+
+	flows := false
+	ast.Inspect(w.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			for _, res := range n.Results {
+				flows = flows || varOf(pass, res) == v
+			}
+		case *ast.CallExpr:
+			for _, arg := range n.Args {
+				flows = flows || (varOf(pass, arg) == v && isSinkArg(cfg, pass, n, arg))
+			}
+		}
+		return !flows
+	})
+	return flows
+}
+
+// funcValueWrapped returns whether a function value returning an error, such
+// as a function literal or a method value, only returns wrapped errors.
+func funcValueWrapped(cfg *Config, pass *analysis.Pass, expr ast.Expr) bool {
+	switch e := astutil.Unparen(expr).(type) {
+	case *ast.FuncLit:
+		return len(nakedReturns(cfg, pass, e)) == 0
+	case *ast.Ident, *ast.SelectorExpr:
+		var ident *ast.Ident
+		if sel, ok := e.(*ast.SelectorExpr); ok {
+			ident = sel.Sel
+		} else {
+			ident = e.(*ast.Ident)
+		}
+		fn, ok := pass.TypesInfo.ObjectOf(ident).(*types.Func)
+		if !ok {
+			return false
+		}
+		fact := wrapFact{}
+		return pass.ImportObjectFact(fn, &fact) && fact.isWrapped
+	}
+	return false
+}
+
+// nakedReturns returns the naked errors returned by a function literal.
+func nakedReturns(cfg *Config, pass *analysis.Pass, lit *ast.FuncLit) []ast.Expr {
+	var naked []ast.Expr
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			// Nested function literals return to their own callers.
+			return false
+		case *ast.ReturnStmt:
+			for _, res := range n.Results {
+				if isError(pass.TypesInfo.TypeOf(res)) && !returnedWrapped(cfg, pass, res) {
+					naked = append(naked, res)
+				}
+			}
+		}
+		return true
+	})
+	return naked
+}
+
+// returnedWrapped returns whether an error value is acceptable where a
+// wrapped error is expected: a nil value, a sentinel that may be returned bare,
+// or a wrapped error.
+func returnedWrapped(cfg *Config, pass *analysis.Pass, expr ast.Expr) bool {
+	if pass.TypesInfo.Types[expr].IsNil() {
+		return true
+	}
+	if _, policy, ok := sentinelOf(cfg, pass, expr); ok {
+		return policy != SentinelMustWrap
+	}
+	return exprWrapped(cfg, pass, expr)
+}
+
+// varOf returns the variable or field an expression designates, seeing
+// through the address operator.
+func varOf(pass *analysis.Pass, expr ast.Expr) types.Object {
+	switch e := astutil.Unparen(expr).(type) {
+	case *ast.Ident:
+		v, _ := pass.TypesInfo.ObjectOf(e).(*types.Var)
+		if v == nil {
+			return nil
+		}
+		return v
+	case *ast.SelectorExpr:
+		v, _ := pass.TypesInfo.ObjectOf(e.Sel).(*types.Var)
+		if v == nil {
+			return nil
+		}
+		return v
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			return varOf(pass, e.X)
+		}
+	}
+	return nil
+}
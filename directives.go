@@ -0,0 +1,101 @@
+package errcheckstack
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+const (
+	// directiveWrapper marks a function as a wrapping function, just like the
+	// configured wrapping signatures.
+	directiveWrapper = "//errcheckstack:wrapper"
+	// directiveNakedOK marks a function whose naked returns are intentional.
+	directiveNakedOK = "//errcheckstack:naked-ok"
+)
+
+// wrapperFact marks functions wrapping the errors given to them, so that
+// dependent packages know about them.
+type wrapperFact struct {
+	// inferred is set for the wrappers inferred from their body rather than
+	// marked with the directive.
+	inferred bool
+}
+
+func (w wrapperFact) AFact() {}
+
+func (w wrapperFact) String() string {
+	if w.inferred {
+		return "inferred wrapper"
+	}
+	return "wrapper"
+}
+
+// GobEncode encodes the fact, whose fields are unexported.
+func (w *wrapperFact) GobEncode() ([]byte, error) {
+	return encodeBool(w.inferred), nil
+}
+
+// GobDecode decodes a fact encoded by GobEncode.
+func (w *wrapperFact) GobDecode(b []byte) error {
+	var err error
+	w.inferred, err = decodeBool(b)
+	return err
+}
+
+// hasDirective returns whether the doc comment of fdecl holds the directive.
+func hasDirective(fdecl *ast.FuncDecl, directive string) bool {
+	if fdecl.Doc == nil {
+		return false
+	}
+	for _, c := range fdecl.Doc.List {
+		if c.Text == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// exportWrapperFacts exports a wrapperFact for the functions of the package
+// marked with the wrapper directive. It runs before the package is scanned,
+// so calls within the package see them as well.
+func exportWrapperFacts(pass *analysis.Pass) {
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fdecl, ok := decl.(*ast.FuncDecl)
+			if !ok || !hasDirective(fdecl, directiveWrapper) {
+				continue
+			}
+			if fn, ok := pass.TypesInfo.Defs[fdecl.Name].(*types.Func); ok {
+				pass.ExportObjectFact(fn, &wrapperFact{})
+			}
+		}
+	}
+}
+
+// isWrapper returns whether fn is a wrapping function, either configured as
+// such or marked with the wrapper directive.
+func isWrapper(cfg *Config, pass *analysis.Pass, fn *types.Func) bool {
+	if isWrappingSignature(cfg, fn) {
+		return true
+	}
+	return pass.ImportObjectFact(fn, &wrapperFact{})
+}
+
+// calledFunc returns the function called, either through a selector or an
+// identifier, if it's statically known.
+func calledFunc(pass *analysis.Pass, call *ast.CallExpr) *types.Func {
+	var ident *ast.Ident
+	switch fun := astutil.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := pass.TypesInfo.ObjectOf(ident).(*types.Func)
+	return fn
+}
@@ -0,0 +1,305 @@
+package errcheckstack
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/jhchabran/errcheckstack/internal/driver"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// EntrypointsConfig restricts the diagnostics to the naked errors flowing into
+// main.main or one of the configured entry functions, such as HTTP handlers.
+//
+// This requires a call graph of the whole program, so it is only available
+// when analyzing all packages at once, see Entrypoints and Check, or the
+// errcheckstack command. The analyzer itself, as run by the singlechecker, go
+// vet or golangci-lint, rejects it.
+type EntrypointsConfig struct {
+	// Enabled turns the entrypoints mode on.
+	Enabled bool `yaml:"enabled"`
+	// Functions lists the entry functions besides main.main, by full name, such
+	// as (*example.com/api.Server).ServeHTTP.
+	Functions []string `yaml:"functions"`
+	// CallGraph is the algorithm building the call graph, either cha, the
+	// default, or vta which is more precise but slower.
+	CallGraph string `yaml:"callGraph"`
+}
+
+// Entrypoints analyzes the packages matching the patterns in dir, and returns
+// the diagnostics located in functions whose errors flow back to main.main or
+// the configured entry functions. The related information of each diagnostic is
+// the call path leading to it, starting from its entrypoint.
+func Entrypoints(dir string, cfg Config, patterns ...string) (*token.FileSet, []analysis.Diagnostic, error) {
+	pkgs, err := driver.Load(context.Background(), dir, nil, patterns...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := driver.Run(context.Background(), newProgramAnalyzer(cfg), pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	diags, err := reachingDiagnostics(pkgs, res, cfg.Entrypoints)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res.Fset, diags, nil
+}
+
+// newProgramAnalyzer returns the analyzer run by the whole program analyses,
+// which handle the entrypoints mode themselves.
+func newProgramAnalyzer(cfg Config) *analysis.Analyzer {
+	cfg.Entrypoints.Enabled = false
+	return NewAnalyzer(cfg)
+}
+
+// reachingDiagnostics returns the diagnostics located in the functions whose
+// errors flow back to the entrypoints, along with their call path.
+func reachingDiagnostics(pkgs []*packages.Package, res *driver.Result, cfg EntrypointsConfig) ([]analysis.Diagnostic, error) {
+	reach, err := newReachability(pkgs, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var diags []analysis.Diagnostic
+	for _, p := range res.Packages {
+		for _, d := range p.Diagnostics {
+			path, ok := reach.pathTo(d.Pos)
+			if !ok {
+				continue
+			}
+			d.Related = append(path, d.Related...)
+			diags = append(diags, d)
+		}
+	}
+	return diags, nil
+}
+
+// reachability tells which functions return errors flowing back to the
+// entrypoints of a program, and through which calls.
+type reachability struct {
+	// funcs are all the functions of the program with a syntax, to locate
+	// the function enclosing a diagnostic.
+	funcs []*ssa.Function
+	// callers maps each reachable function to the edge it's been reached
+	// through, nil for the entrypoints themselves.
+	callers map[*ssa.Function]*callgraph.Edge
+}
+
+func newReachability(pkgs []*packages.Package, ec EntrypointsConfig) (r *reachability, err error) {
+	// The SSA builder of the x/tools version in use predates type parameters
+	// and panics on generic code, which includes the standard library since Go
+	// 1.18. Report it as an error rather than crashing the whole run, which
+	// requires building the packages serially, on this goroutine.
+	defer func() {
+		if p := recover(); p != nil {
+			r, err = nil, fmt.Errorf("building the call graph: %v (generic code isn't supported by the entrypoints mode)", p)
+		}
+	}()
+
+	prog, ssaPkgs := ssautil.AllPackages(pkgs, ssa.BuildSerially)
+	prog.Build()
+
+	var cg *callgraph.Graph
+	switch ec.CallGraph {
+	case "", "cha":
+		cg = cha.CallGraph(prog)
+	case "vta":
+		cg = vta.CallGraph(ssautil.AllFunctions(prog), cha.CallGraph(prog))
+	default:
+		return nil, fmt.Errorf("unknown call graph algorithm %q", ec.CallGraph)
+	}
+
+	var roots []*ssa.Function
+	for _, p := range ssaPkgs {
+		if p == nil || p.Pkg.Name() != "main" {
+			continue
+		}
+		if fn := p.Func("main"); fn != nil {
+			roots = append(roots, fn)
+		}
+	}
+
+	r = &reachability{callers: map[*ssa.Function]*callgraph.Edge{}}
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn.Syntax() != nil {
+			r.funcs = append(r.funcs, fn)
+		}
+		obj, ok := fn.Object().(*types.Func)
+		if !ok {
+			continue
+		}
+		for _, name := range ec.Functions {
+			if obj.FullName() == name {
+				roots = append(roots, fn)
+			}
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].String() < roots[j].String() })
+
+	// Walk the call graph breadth first, so the recorded paths are the shortest,
+	// following only the calls whose errors flow back to the caller.
+	var queue []*ssa.Function
+	for _, root := range roots {
+		if _, ok := r.callers[root]; !ok {
+			r.callers[root] = nil
+			queue = append(queue, root)
+		}
+	}
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+		node := cg.Nodes[fn]
+		if node == nil {
+			continue
+		}
+		isRoot := r.callers[fn] == nil
+		for _, edge := range node.Out {
+			if _, ok := r.callers[edge.Callee.Func]; ok {
+				continue
+			}
+			if !propagates(edge, isRoot) {
+				continue
+			}
+			r.callers[edge.Callee.Func] = edge
+			queue = append(queue, edge.Callee.Func)
+		}
+	}
+
+	return r, nil
+}
+
+// propagates returns whether the error returned by the callee of edge flows
+// back to the caller, i.e. is returned by it. Entrypoints have nowhere to
+// return errors to, so for them it's enough that they use it.
+func propagates(edge *callgraph.Edge, root bool) bool {
+	// Results of go and defer statements are dropped.
+	call, ok := edge.Site.(*ssa.Call)
+	if !ok {
+		return false
+	}
+	results := edge.Callee.Func.Signature.Results()
+	var errs []ssa.Value
+	if results.Len() == 1 && isError(results.At(0).Type()) {
+		errs = append(errs, call)
+	} else if results.Len() > 1 && call.Referrers() != nil {
+		for _, instr := range *call.Referrers() {
+			if ex, ok := instr.(*ssa.Extract); ok && isError(results.At(ex.Index).Type()) {
+				errs = append(errs, ex)
+			}
+		}
+	}
+
+	for _, v := range errs {
+		if root && used(v) {
+			return true
+		}
+		if !root && returned(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// used returns whether v is used, besides debugging information.
+func used(v ssa.Value) bool {
+	if v.Referrers() == nil {
+		return false
+	}
+	for _, instr := range *v.Referrers() {
+		if _, ok := instr.(*ssa.DebugRef); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// returned returns whether v flows into a return statement of its function,
+// either directly or through conversions, phi nodes and local variables, such
+// as named results.
+func returned(v ssa.Value) bool {
+	seen := map[ssa.Value]bool{}
+	queue := []ssa.Value{v}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if seen[cur] || cur.Referrers() == nil {
+			continue
+		}
+		seen[cur] = true
+		for _, instr := range *cur.Referrers() {
+			switch instr := instr.(type) {
+			case *ssa.Return:
+				return true
+			case *ssa.Phi, *ssa.ChangeInterface, *ssa.ChangeType, *ssa.MakeInterface:
+				queue = append(queue, instr.(ssa.Value))
+			case *ssa.Store:
+				if instr.Val != cur || instr.Addr.Referrers() == nil {
+					continue
+				}
+				// Follow the loads of the variable the error is stored in.
+				for _, load := range *instr.Addr.Referrers() {
+					if u, ok := load.(*ssa.UnOp); ok && u.Op == token.MUL {
+						queue = append(queue, u)
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pathTo returns the call path from an entrypoint to the function enclosing
+// pos, or false if that function isn't reachable.
+func (r *reachability) pathTo(pos token.Pos) ([]analysis.RelatedInformation, bool) {
+	// Find the innermost function enclosing pos, which may be a closure.
+	var fn *ssa.Function
+	for _, f := range r.funcs {
+		syntax := f.Syntax()
+		if syntax.Pos() > pos || pos >= syntax.End() {
+			continue
+		}
+		if fn == nil || syntax.Pos() > fn.Syntax().Pos() {
+			fn = f
+		}
+	}
+	if fn == nil {
+		return nil, false
+	}
+	if _, ok := r.callers[fn]; !ok {
+		return nil, false
+	}
+
+	var path []analysis.RelatedInformation
+	for f := fn; ; {
+		edge := r.callers[f]
+		if edge == nil {
+			path = append(path, analysis.RelatedInformation{
+				Pos:     f.Pos(),
+				Message: fmt.Sprintf("entrypoint %s", f),
+			})
+			break
+		}
+		path = append(path, analysis.RelatedInformation{
+			Pos:     edge.Pos(),
+			Message: fmt.Sprintf("%s calls %s", edge.Caller.Func, f),
+		})
+		f = edge.Caller.Func
+	}
+
+	// The path has been built from the end, reverse it.
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, true
+}
@@ -1,13 +1,20 @@
 package errcheckstack
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 
 	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
 )
 
 type Config struct {
@@ -18,17 +25,94 @@ type Config struct {
 	// In order to function, this analyzer requires to be passed a module name so it avoids
 	// inspecting any other packages than the ones in that module.
 	ModuleName string `yaml:"moduleName"`
+	// ErrorfWrapping makes fmt.Errorf calls using the %w verb keep the wrapped
+	// status of their %w operands, instead of always being seen as naked errors
+	// coming from an external package.
+	ErrorfWrapping bool `yaml:"errorfWrapping"`
+	// RedundantWrap enables reporting calls to wrapping functions applied to
+	// errors that are already known to be wrapped, which only adds a second
+	// stack trace to them.
+	RedundantWrap bool `yaml:"redundantWrap"`
+	// MessageWrapper is the full name of a function that annotates an error with
+	// a message without capturing a stack, such as
+	// github.com/cockroachdb/errors.WithMessage. When set, redundant wrapping
+	// calls carrying a message are fixed by calling it instead of being removed.
+	MessageWrapper string `yaml:"messageWrapper"`
+	// Sentinels defines how package level sentinel errors, such as io.EOF, can
+	// be returned.
+	Sentinels SentinelConfig `yaml:"sentinels"`
+	// CheckComparisons enables reporting type assertions, type switches and ==
+	// comparisons against errors that may come from a wrapped source, as they
+	// stop matching once the error is wrapped.
+	CheckComparisons bool `yaml:"checkComparisons"`
+	// Sinks lists the functions consuming errors, such as loggers and error
+	// reporters. Naked errors passed to them are reported.
+	Sinks []Sink `yaml:"sinks"`
+	// Entrypoints restricts the diagnostics to the naked errors reaching
+	// main.main or other entry functions.
+	Entrypoints EntrypointsConfig `yaml:"entrypoints"`
+	// Policy defines which returns must be wrapped. It defaults to
+	// wrap-at-source.
+	Policy Policy `yaml:"policy"`
+	// Rules enables, disables or changes the severity of individual rules,
+	// keyed by rule ID.
+	Rules map[Rule]RuleConfig `yaml:"rules"`
+	// TrustedModules lists the paths of external modules, such as shared
+	// libraries, whose packages are scanned to know which of their functions
+	// return wrapped errors. They are never reported on.
+	TrustedModules []string `yaml:"trustedModules"`
+	// Stubs lists the paths of stub files describing the error behaviour of
+	// external functions and variables that can't be analyzed. Each line of a
+	// stub file is made of a full name and a behaviour, one of wrapped,
+	// naked, sentinel or passthrough(argN), such as:
+	//
+	//	github.com/jackc/pgx/v5.(*Conn).Exec: wrapped
+	//	io.ReadAll: naked
+	Stubs []string `yaml:"stubs"`
+	// StdlibStubs enables the stubs of the standard library shipped with the
+	// analyzer, see stubs/stdlib.stubs. They are opt-in since they change the
+	// outcome for code returning standard sentinels, such as io.EOF, which
+	// become wrapped.
+	StdlibStubs bool `yaml:"stdlibStubs"`
+	// InferWrappers treats the functions of the module wrapping one of their
+	// error arguments with a stack capturing call as wrapping functions,
+	// without having to list them in WrappingSignatures.
+	InferWrappers bool `yaml:"inferWrappers"`
+
+	// stubs are the stubs loaded from the stub files.
+	stubs stubSet
 }
 
 func NewAnalyzer(cfg Config) *analysis.Analyzer {
 	return &analysis.Analyzer{
-		Name:      "errcheckstack",
-		Doc:       "Checks that errors are wrapped before reaching main functions",
-		Run:       run(cfg),
-		FactTypes: []analysis.Fact{new(wrapFact)},
+		Name:       "errcheckstack",
+		Doc:        "Checks that errors are wrapped before reaching main functions",
+		Run:        run(cfg),
+		Requires:   []*analysis.Analyzer{inspect.Analyzer, assignsAnalyzer, syncAnalyzer, fieldsAnalyzer},
+		FactTypes:  []analysis.Fact{new(wrapFact), new(wrapperFact), new(nakedFieldsFact)},
+		ResultType: reflect.TypeOf(new(Result)),
 	}
 }
 
+// Fingerprint returns a hash of the configuration, along with the content of
+// its stub files, which changes whenever the outcome of the analyzer may
+// change for the same sources.
+func (c *Config) Fingerprint() ([]byte, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(c); err != nil {
+		return nil, err
+	}
+	for _, name := range c.Stubs {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "stubs %s %d\n", name, len(b))
+		h.Write(b)
+	}
+	return h.Sum(nil), nil
+}
+
 // wrapFact represents if an object is wrapped or not.
 type wrapFact struct {
 	isWrapped bool
@@ -44,7 +128,37 @@ func (w wrapFact) String() string {
 	}
 }
 
+// GobEncode encodes the fact, whose fields are unexported, for drivers
+// serializing facts such as go vet or the cache of the command.
+func (w *wrapFact) GobEncode() ([]byte, error) {
+	return encodeBool(w.isWrapped), nil
+}
+
+// GobDecode decodes a fact encoded by GobEncode.
+func (w *wrapFact) GobDecode(b []byte) error {
+	var err error
+	w.isWrapped, err = decodeBool(b)
+	return err
+}
+
+func encodeBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func decodeBool(b []byte) (bool, error) {
+	if len(b) != 1 || b[0] > 1 {
+		return false, fmt.Errorf("invalid encoded fact %v", b)
+	}
+	return b[0] == 1, nil
+}
+
 func run(cfg Config) func(*analysis.Pass) (interface{}, error) {
+	// Stubs are loaded once, for all the packages.
+	var loadOnce sync.Once
+	var loadErr error
 	return func(pass *analysis.Pass) (interface{}, error) {
 		if cfg.ModuleName == "" {
 			// The analyzer cannot work without a given module to scope the search,
@@ -53,11 +167,40 @@ func run(cfg Config) func(*analysis.Pass) (interface{}, error) {
 			return nil, fmt.Errorf("no module name given")
 		}
 
+		if err := cfg.Policy.validate(); err != nil {
+			return nil, err
+		}
+		if err := cfg.Sentinels.validate(); err != nil {
+			return nil, err
+		}
+		if err := validateRules(cfg.Rules); err != nil {
+			return nil, err
+		}
+		if cfg.Entrypoints.Enabled {
+			// Packages are analyzed one at a time, without any call graph.
+			return nil, fmt.Errorf("entrypoints require analyzing the whole program, use the errcheckstack command or Check")
+		}
+		loadOnce.Do(func() {
+			cfg.stubs, loadErr = loadStubs(&cfg)
+		})
+		if loadErr != nil {
+			return nil, loadErr
+		}
+
 		// Check if the current package is to be searched or not.
 		pkgPath := pass.Pkg.Path()
 		if !strings.HasPrefix(pkgPath, cfg.ModuleName) {
+			if isTrusted(&cfg, pkgPath) {
+				// Only the facts matter, diagnostics are dropped.
+				quiet := *pass
+				quiet.Report = func(analysis.Diagnostic) {}
+				if _, err := scan(&cfg, &quiet); err != nil {
+					return nil, err
+				}
+			}
+			exportStubFacts(&cfg, pass)
 			// We don't care about this module, immediately return empty results
-			return nil, nil
+			return &Result{Funcs: map[*types.Func]*FuncSummary{}}, nil
 		}
 
 		return scan(&cfg, pass)
@@ -67,6 +210,13 @@ func run(cfg Config) func(*analysis.Pass) (interface{}, error) {
 type errorSource struct {
 	fn      *types.Func
 	wrapped bool
+	// desc describes the source, such as "error returned by strconv.Atoi".
+	desc string
+	// pos is where the error is obtained, such as the call returning it.
+	pos token.Pos
+	// stores are the positions of the naked errors stored in the field the
+	// error is loaded from, if any.
+	stores []token.Pos
 }
 
 func (es *errorSource) String() string {
@@ -104,156 +254,237 @@ func (wc *wrappedCall) IsWrapped() bool {
 // Functions from external packages are always considered to be unwrapped.
 func scan(cfg *Config, pass *analysis.Pass) (interface{}, error) {
 	var curFdecl *wrappedCall
+	var calls []*wrappedCall
 
-	for _, file := range pass.Files {
-		// Because we aren't going over the AST more than once, we don't use inspect.Inspector,
-		// which provides a speed up on the fifth traversal of the AST, which is not the case
-		// here as we're only going through it once.
-		ast.Inspect(file, func(n ast.Node) bool {
-			// Looking at a function declaration, take note and add it to the stack
-			if fdecl, ok := n.(*ast.FuncDecl); ok {
-				if fdecl.Type.Results == nil {
-					return true
-				}
+	exportWrapperFacts(pass)
+	if cfg.InferWrappers {
+		inferWrappers(cfg, pass)
+	}
+
+	// The enclosing nodes are tracked to know whether a return statement belongs
+	// to a function literal rather than the function declaration, and which
+	// file it belongs to.
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ins.WithStack(nil, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		file := stack[0].(*ast.File)
+
+		// Looking at a function declaration, take note and add it to the stack
+		if fdecl, ok := n.(*ast.FuncDecl); ok {
+			curFdecl = nil
+
+			if fdecl.Type.Results == nil {
+				return true
+			}
+
+			if fdecl.Type.Results == nil {
+				// That function does not return any error, skip it.
+				return true
+			}
 
-				if fdecl.Type.Results == nil {
-					// That function does not return any error, skip it.
+			for _, r := range fdecl.Type.Results.List {
+				// TODO check for function returning functions returning errors
+				if pass.TypesInfo.TypeOf(r.Type).String() == "error" {
+					// The function returns an error, it's a candidate for a check and
+					// we add it to the stack.
+					curFdecl = &wrappedCall{fdecl: fdecl}
+					calls = append(calls, curFdecl)
 					return true
 				}
+			}
+		}
 
-				for _, r := range fdecl.Type.Results.List {
-					// TODO check for function returning functions returning errors
-					if pass.TypesInfo.TypeOf(r.Type).String() == "error" {
-						// The function returns an error, it's a candidate for a check and
-						// we add it to the stack.
-						curFdecl = &wrappedCall{fdecl: fdecl}
-						return true
-					}
-				}
+		if call, ok := n.(*ast.CallExpr); ok {
+			checkSink(cfg, pass, call)
+			checkWrappedSentinel(cfg, pass, call)
+			if cfg.RuleEnabled(RuleRedundantWrap) {
+				checkRedundantWrap(cfg, pass, call)
 			}
+		}
 
-			if curFdecl == nil {
-				// We are not inside a function, continue exploring the ast until we find one.
-				return true
+		if cfg.RuleEnabled(RuleComparison) || cfg.RuleEnabled(RuleTypeAssertion) {
+			checkComparison(cfg, pass, file, n)
+		}
+
+		if curFdecl == nil {
+			// We are not inside a function, continue exploring the ast until we find one.
+			return true
+		}
+
+		// addSource records where an error returned by the current function comes
+		// from, and exports its updated fact. Errors returned by function literals
+		// don't flow out of the current function, so they are left out.
+		lit := enclosingFuncLit(stack)
+		addSource := func(es *errorSource, export bool) {
+			if lit != nil {
+				return
+			}
+			curFdecl.errSources = append(curFdecl.errSources, es)
+			if !export {
+				return
+			}
+			callerFn, ok := pass.TypesInfo.ObjectOf(curFdecl.fdecl.Name).(*types.Func)
+			if ok {
+				pass.ExportObjectFact(callerFn, &wrapFact{isWrapped: curFdecl.IsWrapped()})
 			}
+		}
 
-			// Looking at a return statement, search if it includes an error, if yes
-			// check if that error is wrapped.
-			if ret, ok := n.(*ast.ReturnStmt); ok {
-				for _, expr := range ret.Results {
-					// Check if the return expression is a function call, if it is, we need
-					// to handle it by checking the return params of the function.
-					retFn, rok := expr.(*ast.CallExpr)
-					if rok {
-						// If the return type of the function is a single error. This will not
-						// match an error within multiple return values, for that, the below
-						// tuple check is required.
-						if isError(pass.TypesInfo.TypeOf(expr)) {
-							b := checkWrapped(cfg, pass, retFn, retFn.Pos())
-							if !b {
-								reportUnwrapped(pass, retFn, retFn.Pos())
-							}
-							fn := extractFunc(pass.TypesInfo, retFn.Fun)
-							callerFn, ok := pass.TypesInfo.ObjectOf(curFdecl.fdecl.Name).(*types.Func)
-							if ok {
-								fmt.Println("wrapped: ", b && curFdecl.IsWrapped())
-								pass.ExportObjectFact(callerFn, &wrapFact{isWrapped: b && curFdecl.IsWrapped()})
-							}
-							curFdecl.errSources = append(curFdecl.errSources, &errorSource{wrapped: b, fn: fn})
-							return true
+		// Wrapping calls assigned to error variables, to be returned later, are
+		// checked like the returned ones.
+		if ass, ok := n.(*ast.AssignStmt); ok {
+			for _, rhs := range ass.Rhs {
+				if call, ok := rhs.(*ast.CallExpr); ok && isError(pass.TypesInfo.TypeOf(call)) {
+					checkWrappedArg(cfg, pass, file, call)
+				}
+			}
+		}
+
+		// The naked errors returned by the functions passed to errgroup.Group.Go
+		// are reported once, where the group is waited for, as long as the error
+		// of the group is returned or passed to a sink there.
+		if _, ok := n.(*ast.ReturnStmt); ok && lit != nil && startedOnReportedGroup(cfg, pass, lit) {
+			return true
+		}
+
+		// Looking at a return statement, search if it includes an error, if yes
+		// check if that error is wrapped.
+		if ret, ok := n.(*ast.ReturnStmt); ok {
+			for _, expr := range ret.Results {
+				// Errors received from a channel or loaded from a field are as wrapped
+				// as the errors sent on it or stored in it.
+				if src, ok := valueSource(pass, expr); ok && isError(pass.TypesInfo.TypeOf(expr)) {
+					b := checkSource(cfg, pass, curFdecl.fdecl, src, src.Pos())
+					addSource(&errorSource{wrapped: b, desc: sourceDesc(src), pos: src.Pos(), stores: sourceStores(cfg, pass, src)}, true)
+					continue
+				}
+
+				// Check if the return expression is a function call, if it is, we need
+				// to handle it by checking the return params of the function.
+				retFn, rok := expr.(*ast.CallExpr)
+				if rok {
+					// If the return type of the function is a single error. This will not
+					// match an error within multiple return values, for that, the below
+					// tuple check is required.
+					if isError(pass.TypesInfo.TypeOf(expr)) {
+						b := checkWrapped(cfg, pass, retFn, retFn.Pos())
+						if !b {
+							reportUnwrapped(cfg, pass, curFdecl.fdecl, retFn, retFn.Pos())
 						}
+						checkWrappedArg(cfg, pass, file, retFn)
+						fn := extractFunc(pass.TypesInfo, retFn.Fun)
+						addSource(&errorSource{wrapped: b, fn: fn, desc: callDesc(fn), pos: retFn.Pos()}, true)
+						return true
 					}
+				}
 
-					// Check if that element of the return tuple is an error.
-					if !isError(pass.TypesInfo.TypeOf(expr)) {
-						continue
-					}
+				// Check if that element of the return tuple is an error.
+				if !isError(pass.TypesInfo.TypeOf(expr)) {
+					continue
+				}
 
-					// It is an error. Let's find where it's been assigned, so we can check it.
-					ident, iok := expr.(*ast.Ident)
-					if !iok {
-						return true
+				// Sentinel errors are returned as is, their policy tells if that's fine.
+				if v, policy, ok := sentinelOf(cfg, pass, expr); ok {
+					b := policy != SentinelMustWrap
+					if rule, ok := policyRule(cfg, pass, curFdecl.fdecl); !b && ok {
+						reportf(cfg, pass, RuleSentinel, expr.Pos(), "sentinel error %s is returned without being wrapped%s", sentinelName(v), rule)
 					}
-					var call *ast.CallExpr
-
-					// Attempt to find the most recent short assign
-					assignments := prevErrAssign(pass, file, ident)
-					for _, shortAss := range assignments {
-						if shortAss != nil {
-							call, ok = shortAss.Rhs[0].(*ast.CallExpr)
-							if !ok {
-								return true
-							}
-							b := checkWrapped(cfg, pass, call, ident.NamePos)
-							fn := extractFunc(pass.TypesInfo, call.Fun)
-							curFdecl.errSources = append(curFdecl.errSources, &errorSource{wrapped: b, fn: fn})
-							if !b {
-								reportUnwrapped(pass, call, ident.NamePos)
-							}
-							sel, ok := call.Fun.(*ast.SelectorExpr)
-							if ok {
-								if !isFromOtherPkg(pass, sel) {
-									pass.ExportObjectFact(fn, &wrapFact{isWrapped: b})
-								}
-							}
-						} else if isUnresolved(file, ident) {
-							// TODO Check if the identifier is unresolved, and try to resolve it in
-							// another file.
-							fmt.Println("unresolved", file)
+					addSource(&errorSource{wrapped: b, desc: "sentinel error " + sentinelName(v), pos: expr.Pos()}, true)
+					continue
+				}
+
+				// It is an error. Let's find where it's been assigned, so we can check it.
+				ident, iok := expr.(*ast.Ident)
+				if !iok {
+					return true
+				}
+				var call *ast.CallExpr
+
+				// Attempt to find the most recent short assign
+				assignments := prevErrAssign(pass, ident)
+				for _, shortAss := range assignments {
+					if shortAss != nil {
+						if src, ok := valueSource(pass, shortAss.Rhs[0]); ok {
+							b := checkSource(cfg, pass, curFdecl.fdecl, src, ident.NamePos)
+							addSource(&errorSource{wrapped: b, desc: sourceDesc(src), pos: src.Pos(), stores: sourceStores(cfg, pass, src)}, true)
+							continue
+						}
+						call, ok = shortAss.Rhs[0].(*ast.CallExpr)
+						if !ok {
 							return true
-						} else {
-							// Check for ValueSpec nodes in order to locate a possible var
-							// declaration.
-							if ident.Obj == nil {
-								return true
+						}
+						b := checkWrapped(cfg, pass, call, ident.NamePos)
+						fn := extractFunc(pass.TypesInfo, call.Fun)
+						addSource(&errorSource{wrapped: b, fn: fn, desc: callDesc(fn), pos: call.Pos()}, false)
+						if !b {
+							reportUnwrapped(cfg, pass, curFdecl.fdecl, call, ident.NamePos)
+						}
+						sel, ok := call.Fun.(*ast.SelectorExpr)
+						if ok {
+							if !isFromOtherPkg(pass, sel) {
+								pass.ExportObjectFact(fn, &wrapFact{isWrapped: b})
 							}
+						}
+					} else {
+						// Check for ValueSpec nodes in order to locate a possible var
+						// declaration.
+						if ident.Obj == nil {
+							return true
+						}
 
-							vSpec, ok := ident.Obj.Decl.(*ast.ValueSpec)
-							if !ok {
-								// We couldn't find a short or var assign for this error return.
-								// This is an error. Where did this identifier come from? Possibly a
-								// function param.
-								//
-								// TODO decide how to handle this case, whether to follow function
-								// param back, or assert wrapping at call site.
+						vSpec, ok := ident.Obj.Decl.(*ast.ValueSpec)
+						if !ok {
+							// We couldn't find a short or var assign for this error return.
+							// This is an error. Where did this identifier come from? Possibly a
+							// function param.
+							//
+							// TODO decide how to handle this case, whether to follow function
+							// param back, or assert wrapping at call site.
 
-								return true
-							}
+							return true
+						}
 
-							if len(vSpec.Values) < 1 {
-								return true
-							}
+						if len(vSpec.Values) < 1 {
+							return true
+						}
 
-							call, ok = vSpec.Values[0].(*ast.CallExpr)
-							if !ok {
-								return true
-							}
+						call, ok = vSpec.Values[0].(*ast.CallExpr)
+						if !ok {
+							return true
 						}
 					}
+				}
 
-					// Make sure there is a call identified as producing the error being
-					// returned, otherwise just bail.
-					if call == nil {
-						return true
-					}
-					b := checkWrapped(cfg, pass, call, ident.NamePos)
-					fn := extractFunc(pass.TypesInfo, call.Fun)
-					curFdecl.errSources = append(curFdecl.errSources, &errorSource{wrapped: b, fn: fn})
-					callerFn, ok := pass.TypesInfo.ObjectOf(curFdecl.fdecl.Name).(*types.Func)
-					if ok {
-						pass.ExportObjectFact(callerFn, &wrapFact{isWrapped: b && curFdecl.IsWrapped()})
-					}
+				// Make sure there is a call identified as producing the error being
+				// returned, otherwise just bail.
+				if call == nil {
+					return true
 				}
+				b := checkWrapped(cfg, pass, call, ident.NamePos)
+				fn := extractFunc(pass.TypesInfo, call.Fun)
+				addSource(&errorSource{wrapped: b, fn: fn, desc: callDesc(fn), pos: call.Pos()}, true)
 			}
+		}
 
-			// fn, ok := pass.TypesInfo.Defs[fdecl.Name].(*types.Func)
-			// Type information may be incomplete.
+		// fn, ok := pass.TypesInfo.Defs[fdecl.Name].(*types.Func)
+		// Type information may be incomplete.
 
+		return true
+	})
+	exportFieldFacts(cfg, pass)
+
+	return newResult(pass, calls), nil
+}
+
+// isTrusted returns whether the package belongs to one of the trusted modules.
+func isTrusted(cfg *Config, pkgPath string) bool {
+	for _, m := range cfg.TrustedModules {
+		if pkgPath == m || strings.HasPrefix(pkgPath, m+"/") {
 			return true
-		})
+		}
 	}
-
-	return nil, nil
+	return false
 }
 
 // isError returns whether or not the provided type interface is an error
@@ -266,17 +497,38 @@ func isError(typ types.Type) bool {
 }
 
 func checkWrapped(cfg *Config, pass *analysis.Pass, call *ast.CallExpr, tokenPos token.Pos) bool {
-	sel, ok := call.Fun.(*ast.SelectorExpr)
-	if !ok {
+	// Check if that function call is part of the wrapping functions, which
+	// may be called from within their own package.
+	if fn := calledFunc(pass, call); fn != nil && isWrapper(cfg, pass, fn) {
+		return true
+	}
+
+	// Calls without a static callee, such as the ones of func values, can't
+	// be told anything about.
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil {
 		return false
 	}
+	sel := call.Fun.(*ast.SelectorExpr)
 
-	// Check if that function call is part of the wrapping functions.
-	fn := pass.TypesInfo.ObjectOf(sel.Sel).(*types.Func)
-	for _, fullname := range cfg.WrappingSignatures {
-		if fn.FullName() == fullname {
-			return true
-		}
+	// fmt.Errorf is only as wrapped as the errors it wraps with %w.
+	if isErrorfWrapping(cfg, fn) {
+		return errorfWrapped(cfg, pass, call)
+	}
+
+	// The message wrapper is only as wrapped as the error it annotates.
+	if isMessageWrapper(cfg, fn) && len(call.Args) > 0 {
+		return exprWrapped(cfg, pass, call.Args[0])
+	}
+
+	// errgroup.Group.Wait is only as wrapped as the functions passed to Go.
+	if wrapped, ok := groupWaitWrapped(cfg, pass, call); ok {
+		return wrapped
+	}
+
+	// External functions described by a stub behave as it says.
+	if wrapped, ok := stubWrappedCall(cfg, pass, fn, call); ok {
+		return wrapped
 	}
 
 	// Check if that function call is marked as wrapped by a previous pass.
@@ -302,6 +554,121 @@ func checkWrapped(cfg *Config, pass *analysis.Pass, call *ast.CallExpr, tokenPos
 	return false
 }
 
+// exprWrapped returns whether an expression of type error is wrapped, by
+// looking at the sources producing it.
+func exprWrapped(cfg *Config, pass *analysis.Pass, expr ast.Expr) bool {
+	sources, ok := errorSources(pass, expr)
+	if !ok || len(sources) == 0 {
+		return false
+	}
+	for _, src := range sources {
+		if !sourceWrapped(cfg, pass, src) {
+			return false
+		}
+	}
+	return true
+}
+
+// mayBeWrapped returns whether an expression of type error may hold a wrapped
+// error, because at least one of the sources producing it is wrapped.
+func mayBeWrapped(cfg *Config, pass *analysis.Pass, expr ast.Expr) bool {
+	sources, _ := errorSources(pass, expr)
+	for _, src := range sources {
+		if sourceWrapped(cfg, pass, src) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceWrapped returns whether the error produced by a source, as returned by
+// errorSources, is wrapped.
+func sourceWrapped(cfg *Config, pass *analysis.Pass, src ast.Expr) bool {
+	if recv, ok := isReceive(src); ok {
+		return chanWrapped(cfg, pass, recv)
+	}
+	if sel, ok := errorField(pass, src); ok {
+		wrapped, _, _, _ := fieldWrapped(cfg, pass, sel)
+		return wrapped
+	}
+	if call, ok := src.(*ast.CallExpr); ok {
+		return checkWrapped(cfg, pass, call, call.Pos())
+	}
+	return false
+}
+
+// errorSources returns the expressions producing the value of an expression of
+// type error, either directly or through the assignments of the variable holding
+// it. Sources are either calls or value sources, see valueSource.
+// It returns false if some of the values can't be traced back to a source.
+func errorSources(pass *analysis.Pass, expr ast.Expr) ([]ast.Expr, bool) {
+	if src, ok := valueSource(pass, expr); ok {
+		return []ast.Expr{src}, true
+	}
+
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return errorSources(pass, e.X)
+	case *ast.CallExpr:
+		return []ast.Expr{e}, true
+	case *ast.Ident:
+		assignments := prevErrAssign(pass, e)
+		if len(assignments) == 0 {
+			if e.Obj == nil {
+				return nil, false
+			}
+			vSpec, ok := e.Obj.Decl.(*ast.ValueSpec)
+			if !ok || len(vSpec.Values) < 1 {
+				return nil, false
+			}
+			call, ok := vSpec.Values[0].(*ast.CallExpr)
+			if !ok {
+				return nil, false
+			}
+			return []ast.Expr{call}, true
+		}
+
+		// Use the most recent assignment preceding the expression, if any.
+		var last *ast.AssignStmt
+		for _, ass := range assignments {
+			if ass.Pos() < e.Pos() && (last == nil || ass.Pos() > last.Pos()) {
+				last = ass
+			}
+		}
+		if last != nil {
+			assignments = []*ast.AssignStmt{last}
+		}
+
+		var sources []ast.Expr
+		traced := true
+		for _, ass := range assignments {
+			if src, ok := valueSource(pass, ass.Rhs[0]); ok {
+				sources = append(sources, src)
+				continue
+			}
+			call, ok := ass.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				traced = false
+				continue
+			}
+			sources = append(sources, call)
+		}
+		return sources, traced
+	}
+
+	return nil, false
+}
+
+// isWrappingSignature returns whether fn is one of the configured wrapping functions.
+func isWrappingSignature(cfg *Config, fn *types.Func) bool {
+	for _, fullname := range cfg.WrappingSignatures {
+		if fn.FullName() == fullname {
+			return true
+		}
+	}
+	return false
+}
+
 // isInterface returns whether the function call is one defined on an interface.
 func isInterface(pass *analysis.Pass, sel *ast.SelectorExpr) bool {
 	_, ok := pass.TypesInfo.TypeOf(sel.X).Underlying().(*types.Interface)
@@ -321,42 +688,16 @@ func isFromOtherPkg(pass *analysis.Pass, sel *ast.SelectorExpr) bool {
 	return true
 }
 
-// prevErrAssign traverses the AST of a file looking for the all assignments
-// to an error declaration which is specified by the returnIdent identifier.
+// prevErrAssign returns all the assignments to the error variable specified by
+// the returnIdent identifier. This is to catch cases where err is defined once,
+// and then reassigned multiple times within the same block. In these cases, we
+// should check the method of the most recent call.
 //
 // This only returns short form assignments and reassignments, e.g. `:=` and
 // `=`. This does not include `var` statements. This function will return nil if
 // the only declaration is a `var` (aka ValueSpec) declaration.
-func prevErrAssign(pass *analysis.Pass, file *ast.File, returnIdent *ast.Ident) []*ast.AssignStmt {
-	// A slice containing all the assignments which contain an identifer
-	// referring to the source declaration of the error. This is to catch
-	// cases where err is defined once, and then reassigned multiple times
-	// within the same block. In these cases, we should check the method of
-	// the most recent call.
-	var assigns []*ast.AssignStmt
-
-	// Find all assignments which have the same declaration
-	ast.Inspect(file, func(n ast.Node) bool {
-		if ass, ok := n.(*ast.AssignStmt); ok {
-			for _, expr := range ass.Lhs {
-				if !isError(pass.TypesInfo.TypeOf(expr)) {
-					continue
-				}
-				if assIdent, ok := expr.(*ast.Ident); ok {
-					if assIdent.Obj == nil || returnIdent.Obj == nil {
-						// If we can't find the Obj for one of the identifiers, just skip it.
-						return true
-					} else if assIdent.Obj.Decl == returnIdent.Obj.Decl {
-						assigns = append(assigns, ass)
-					}
-				}
-			}
-		}
-
-		return true
-	})
-
-	return assigns
+func prevErrAssign(pass *analysis.Pass, returnIdent *ast.Ident) []*ast.AssignStmt {
+	return pass.ResultOf[assignsAnalyzer].(*assignIndex).assignments(returnIdent)
 }
 
 func contains(slice []string, el string) bool {
@@ -368,15 +709,6 @@ func contains(slice []string, el string) bool {
 	return false
 }
 
-func isUnresolved(file *ast.File, ident *ast.Ident) bool {
-	for _, unresolvedIdent := range file.Unresolved {
-		if unresolvedIdent.Pos() == ident.Pos() {
-			return true
-		}
-	}
-	return false
-}
-
 func extractFunc(typesInfo *types.Info, fun ast.Expr) *types.Func {
 	sel, ok := fun.(*ast.SelectorExpr)
 	if !ok {
@@ -389,21 +721,123 @@ func extractFunc(typesInfo *types.Info, fun ast.Expr) *types.Func {
 	return nil
 }
 
-func reportUnwrapped(pass *analysis.Pass, call *ast.CallExpr, tokenPos token.Pos) {
-	sel, ok := call.Fun.(*ast.SelectorExpr)
+func reportUnwrapped(cfg *Config, pass *analysis.Pass, fdecl *ast.FuncDecl, call *ast.CallExpr, tokenPos token.Pos) {
+	origin, id, ok := unwrappedOrigin(cfg, pass, call)
+	if !ok {
+		return
+	}
+	rule, ok := policyRule(cfg, pass, fdecl)
 	if !ok {
 		return
 	}
+	d := analysis.Diagnostic{Pos: tokenPos, Message: fmt.Sprintf("error %s is not wrapped%s", origin, rule)}
+	if tokenPos != call.Pos() {
+		// The error is returned away from the call producing it.
+		d.Related = append(d.Related, analysis.RelatedInformation{
+			Pos:     call.Pos(),
+			End:     call.End(),
+			Message: callDesc(extractFunc(pass.TypesInfo, call.Fun)),
+		})
+	}
+	if id == RuleErrgroup {
+		for _, n := range groupNakedFuncs(cfg, pass, call) {
+			d.Related = append(d.Related, analysis.RelatedInformation{
+				Pos:     n.Pos(),
+				End:     n.End(),
+				Message: "naked error returned to errgroup.Group.Go",
+			})
+		}
+	}
+	report(cfg, pass, id, d)
+}
+
+// valueSource returns the source of errors expr is made of, when it isn't a
+// call: either a channel receive, or a load from a struct field.
+func valueSource(pass *analysis.Pass, expr ast.Expr) (ast.Expr, bool) {
+	if recv, ok := isReceive(expr); ok {
+		return recv, true
+	}
+	if sel, ok := errorField(pass, expr); ok {
+		return sel, true
+	}
+	return nil, false
+}
+
+// checkSource returns whether an error produced by a value source, as
+// returned by valueSource, is wrapped, and reports it otherwise.
+func checkSource(cfg *Config, pass *analysis.Pass, fdecl *ast.FuncDecl, src ast.Expr, tokenPos token.Pos) bool {
+	if sourceWrapped(cfg, pass, src) {
+		return true
+	}
+	origin, id, ok := sourceOrigin(cfg, pass, src)
+	if !ok {
+		return false
+	}
+	if rule, ok := policyRule(cfg, pass, fdecl); ok {
+		d := analysis.Diagnostic{Pos: tokenPos, Message: fmt.Sprintf("error %s is not wrapped%s", origin, rule)}
+		if tokenPos != src.Pos() {
+			d.Related = append(d.Related, analysis.RelatedInformation{Pos: src.Pos(), End: src.End(), Message: sourceDesc(src)})
+		}
+		for _, pos := range sourceStores(cfg, pass, src) {
+			d.Related = append(d.Related, analysis.RelatedInformation{Pos: pos, Message: "naked error stored in field " + types.ExprString(src)})
+		}
+		report(cfg, pass, id, d)
+	}
+	return false
+}
+
+// sourceStores returns the positions of the naked errors stored in the field
+// src loads, if any.
+func sourceStores(cfg *Config, pass *analysis.Pass, src ast.Expr) []token.Pos {
+	sel, ok := errorField(pass, src)
+	if !ok {
+		return nil
+	}
+	_, nakedStores, _, _ := fieldWrapped(cfg, pass, sel)
+	return nakedStores
+}
+
+// sourceOrigin describes where the naked error produced by a source, as
+// returned by errorSources, comes from, along with the rule it breaks. It returns false for
+// sources that aren't reported.
+func sourceOrigin(cfg *Config, pass *analysis.Pass, src ast.Expr) (string, Rule, bool) {
+	if recv, ok := isReceive(src); ok {
+		return fmt.Sprintf("received from channel %s", types.ExprString(recv.X)), RuleChannel, true
+	}
+	if sel, ok := errorField(pass, src); ok {
+		origin, ok := fieldOrigin(cfg, pass, sel)
+		return origin, RuleField, ok
+	}
+	if call, ok := src.(*ast.CallExpr); ok {
+		return unwrappedOrigin(cfg, pass, call)
+	}
+	return "", "", false
+}
+
+// unwrappedOrigin describes where the naked error produced by a call comes from,
+// along with the rule it breaks. It returns false for calls that aren't reported.
+func unwrappedOrigin(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) (string, Rule, bool) {
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil {
+		return "", "", false
+	}
+	sel := call.Fun.(*ast.SelectorExpr)
+
+	if isErrorfWrapping(cfg, fn) && len(errorfOperands(pass, call)) > 0 {
+		return "wrapped with fmt.Errorf %w", RuleErrorf, true
+	}
+
+	if fn.FullName() == errgroupWait {
+		return "returned by a function passed to errgroup.Group.Go", RuleErrgroup, true
+	}
 
 	if isInterface(pass, sel) {
-		pass.Reportf(tokenPos, "error returned from interface type is not wrapped")
-		return
+		return "returned from interface type", RuleInterface, true
 	}
 
 	if isFromOtherPkg(pass, sel) {
-		pass.Reportf(tokenPos, "error returned from external package is not wrapped")
-		return
+		return "returned from external package", RuleExternal, true
 	}
 
-	pass.Reportf(tokenPos, "error returned is not wrapped")
+	return "returned", RuleLocal, true
 }
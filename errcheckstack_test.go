@@ -1,12 +1,21 @@
 package errcheckstack
 
 import (
+	"context"
+	"fmt"
+	"go/build"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	_ "github.com/cockroachdb/errors"
+	"github.com/jhchabran/errcheckstack/internal/driver"
 	"github.com/stretchr/testify/assert"
+	_ "golang.org/x/sync/errgroup"
+	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/analysistest"
 )
 
@@ -15,6 +24,48 @@ var vendoredDeps []string = []string{
 	"golang.org",
 	"gopkg.in",
 	"modules.txt",
+	// Trusted by the trusted test package.
+	"mycorp.com",
+}
+
+// testConfigs holds the configuration of the test packages exercising optional
+// behaviours. The wrapping signatures and the module name are always set by
+// the test itself.
+var testConfigs = map[string]Config{
+	"comparison":      {CheckComparisons: true},
+	"errorf_wrap":     {ErrorfWrapping: true},
+	"policy_boundary": {Policy: PolicyBoundary},
+	"policy_exported": {Policy: PolicyExported},
+	"redundant_wrap": {
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.Wrap", "github.com/cockroachdb/errors.Wrapf", "github.com/pkg/errors.Wrap"},
+		RedundantWrap:      true,
+		MessageWrapper:     "github.com/cockroachdb/errors.WithMessage",
+	},
+	"rules": {
+		Rules: map[Rule]RuleConfig{
+			RuleExternal:   {Enabled: boolPtr(false)},
+			RuleComparison: {Enabled: boolPtr(true), Severity: SeverityWarning},
+		},
+	},
+	"inference": {InferWrappers: true},
+	"stubs":     {Stubs: []string{"testdata/src/stubs/app.stubs"}, StdlibStubs: true},
+	"trusted":   {TrustedModules: []string{"mycorp.com"}},
+	"sink": {
+		Sinks: []Sink{
+			{Signature: "log.Printf", ErrArg: 1},
+			{Signature: "log.Fatal", ErrArg: 0},
+		},
+	},
+	"sentinel": {
+		Sentinels: SentinelConfig{
+			Allowed: []Sentinel{
+				{Name: "io.EOF"},
+				{Name: "context.Canceled", Policy: SentinelMustWrap},
+				{Name: "database/sql.ErrNoRows", Policy: SentinelMustNotWrap},
+			},
+			AutoDetect: true,
+		},
+	},
 }
 
 func TestAnalyzer(t *testing.T) {
@@ -35,12 +86,437 @@ OUTER:
 			t.Fatalf("cannot run on non-directory: %s", f.Name())
 		}
 
-		cfg := Config{
-			WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
-			ModuleName:         f.Name(),
-		}
+		cfg := testConfigs[f.Name()]
+		cfg.WrappingSignatures = append(cfg.WrappingSignatures, "github.com/cockroachdb/errors.WithStack")
+		cfg.ModuleName = f.Name()
 		t.Run(f.Name(), func(t *testing.T) {
-			analysistest.Run(t, analysistest.TestData(), NewAnalyzer(cfg), f.Name()+"/...")
+			analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), NewAnalyzer(cfg), f.Name()+"/...")
+		})
+	}
+}
+
+// useGopath runs the test in GOPATH mode, with gopath as the GOPATH.
+func useGopath(tb testing.TB, gopath string) {
+	tb.Setenv("GOPATH", gopath)
+	tb.Setenv("GO111MODULE", "off")
+	tb.Setenv("GOPROXY", "off")
+}
+
+// testdataGopath runs the test in GOPATH mode over testdata, and returns its
+// absolute path.
+func testdataGopath(tb testing.TB) string {
+	p, err := filepath.Abs("./testdata")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	useGopath(tb, p)
+	return p
+}
+
+// writeGopathPackage writes the files, keyed by their path relative to the src
+// directory of gopath.
+func writeGopathPackage(tb testing.TB, gopath string, files map[string]string) {
+	for name, src := range files {
+		path := filepath.Join(gopath, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestEntrypoints(t *testing.T) {
+	p := testdataGopath(t)
+
+	cfg := Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "entrypoints",
+		Entrypoints: EntrypointsConfig{
+			Enabled:   true,
+			Functions: []string{"entrypoints/a.Handler"},
+		},
+	}
+	fset, diags, err := Entrypoints(filepath.Join(p, "src", "entrypoints"), cfg, "entrypoints/...")
+	if goVersionAtLeast("go1.18") {
+		// The standard library is generic, which the SSA builder can't handle.
+		assert.Error(t, err)
+		t.Skip("the entrypoints mode doesn't support generic code")
+	}
+	assert.NoError(t, err)
+
+	var got []string
+	for _, d := range diags {
+		line := fmt.Sprintf("%d: %s", fset.Position(d.Pos).Line, d.Message)
+		for _, r := range d.Related {
+			line += fmt.Sprintf("\n\t%d: %s", fset.Position(r.Pos).Line, r.Message)
+		}
+		got = append(got, line)
+	}
+	sort.Strings(got)
+
+	assert.Equal(t, []string{
+		"10: error returned from external package is not wrapped\n" +
+			"\t9: entrypoint entrypoints.main\n" +
+			"\t10: entrypoints.main calls entrypoints.run\n" +
+			"\t18: entrypoints.run calls entrypoints/a.Propagated",
+		"18: error returned from external package is not wrapped\n" +
+			"\t17: entrypoint entrypoints/a.Handler",
+		"18: error returned from external package is not wrapped\n" +
+			"\t9: entrypoint entrypoints.main\n" +
+			"\t10: entrypoints.main calls entrypoints.run",
+	}, got)
+
+	// Analyzed one package at a time, the analyzer rejects the mode.
+	pkgs, err := driver.Load(context.Background(), filepath.Join(p, "src", "entrypoints"), nil, "entrypoints/a")
+	assert.NoError(t, err)
+	_, err = driver.Run(context.Background(), NewAnalyzer(cfg), pkgs)
+	assert.Error(t, err)
+}
+
+func TestComputeStats(t *testing.T) {
+	p := testdataGopath(t)
+
+	cfg := Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "concurrency",
+	}
+	stats, err := ComputeStats(filepath.Join(p, "src", "concurrency"), cfg, "concurrency/...")
+	assert.NoError(t, err)
+
+	assert.Equal(t, &Stats{
+		Packages: []PackageStats{
+			{Path: "concurrency", Counts: Counts{Total: 6, Wrapped: 2, Naked: 3, Unknown: 1}},
+			{Path: "concurrency/a", Counts: Counts{Total: 2, Wrapped: 1, Naked: 1}},
+		},
+		Module: Counts{Total: 8, Wrapped: 3, Naked: 4, Unknown: 1},
+		NakedCallees: []CalleeStats{
+			{Callee: "(*golang.org/x/sync/errgroup.Group).Wait", NakedFunctions: 2},
+			{Callee: "fmt.Errorf", NakedFunctions: 1},
+		},
+	}, stats)
+}
+
+func TestErrorGraph(t *testing.T) {
+	p := testdataGopath(t)
+
+	cfg := Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "concurrency",
+	}
+	g, err := ErrorGraph(filepath.Join(p, "src", "concurrency"), cfg, "concurrency/...")
+	assert.NoError(t, err)
+
+	assert.Equal(t, &Graph{
+		Nodes: []GraphNode{
+			{ID: "concurrency/a.Naked", Package: "concurrency/a", Status: StatusNaked},
+			{ID: "fmt.Errorf", Package: "fmt", Status: StatusUnknown},
+		},
+		Edges: []GraphEdge{
+			{From: "concurrency/a.Naked", To: "fmt.Errorf", Wrapped: false},
+		},
+	}, g.FilterFunc("concurrency/a.Naked"))
+
+	assert.Equal(t, &Graph{
+		Nodes: []GraphNode{
+			{ID: "concurrency/a.Naked", Package: "concurrency/a", Status: StatusNaked},
+			{ID: "concurrency/a.Wrapped", Package: "concurrency/a", Status: StatusWrapped},
+			{ID: "fmt.Errorf", Package: "fmt", Status: StatusUnknown},
+			{ID: "github.com/cockroachdb/errors.WithStack", Package: "github.com/cockroachdb/errors", Status: StatusUnknown},
+		},
+		Edges: []GraphEdge{
+			{From: "concurrency/a.Naked", To: "fmt.Errorf", Wrapped: false},
+			{From: "concurrency/a.Wrapped", To: "github.com/cockroachdb/errors.WithStack", Wrapped: true},
+		},
+	}, g.FilterPackage("concurrency/a"))
+}
+
+func TestCheck(t *testing.T) {
+	p := testdataGopath(t)
+
+	cfg := Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "concurrency",
+	}
+	report, err := Check(context.Background(), filepath.Join(p, "src", "concurrency"), cfg, "concurrency/...")
+	assert.NoError(t, err)
+
+	var findings []string
+	for _, f := range report.Findings {
+		findings = append(findings, fmt.Sprintf("%s:%d: %s (%s, %s)", filepath.Base(f.Pos.Filename), f.Pos.Line, f.Message, f.Rule, f.Severity))
+	}
+	assert.Equal(t, []string{
+		"a.go:14: error returned from external package is not wrapped (external, error)",
+		"main.go:35: error returned by a function passed to errgroup.Group.Go is not wrapped (errgroup, error)",
+		"main.go:52: error received from channel errCh is not wrapped (channel, error)",
+		"main.go:59: error returned from external package is not wrapped (external, error)",
+		"main.go:73: error returned by a function passed to errgroup.Group.Go is not wrapped (errgroup, error)",
+	}, findings)
+
+	var funcs []string
+	for _, f := range report.Functions {
+		funcs = append(funcs, fmt.Sprintf("%s %s", f.Name, f.Status))
+	}
+	assert.Equal(t, []string{
+		"concurrency/a.Wrapped wrapped",
+		"concurrency/a.Naked naked",
+		"concurrency.group wrapped",
+		"concurrency.nakedGroup naked",
+		"concurrency.channel wrapped",
+		"concurrency.nakedChannel naked",
+		"concurrency.loggedGroup unknown",
+		"concurrency.returnedGroup naked",
+	}, funcs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Check(ctx, filepath.Join(p, "src", "concurrency"), cfg, "concurrency/...")
+	assert.Error(t, err)
+}
+
+func TestResult(t *testing.T) {
+	p := testdataGopath(t)
+
+	errcheck := NewAnalyzer(Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "fields",
+	})
+	var got []string
+	dependent := &analysis.Analyzer{
+		Name:     "dependent",
+		Doc:      "builds on the result of errcheckstack",
+		Requires: []*analysis.Analyzer{errcheck},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			for fn, summary := range pass.ResultOf[errcheck].(*Result).Funcs {
+				got = append(got, fmt.Sprintf("%s %s %s", fn.FullName(), summary.Status, summary.Reason))
+			}
+			return nil, nil
+		},
+	}
+
+	pkgs, err := driver.Load(context.Background(), filepath.Join(p, "src", "fields"), nil, "fields/...")
+	assert.NoError(t, err)
+	_, err = driver.Run(context.Background(), dependent, pkgs)
+	assert.NoError(t, err)
+
+	sort.Strings(got)
+	assert.Equal(t, []string{
+		"(*fields.server).last naked error loaded from field s.lastErr is not wrapped",
+		"(*fields.server).ok wrapped ",
+		"fields.filled naked error loaded from field s.Err is not wrapped",
+		"fields.loaded naked error loaded from field s.Err is not wrapped",
+		"fields.use wrapped ",
+	}, got)
+}
+
+func TestInferWrappers(t *testing.T) {
+	p := testdataGopath(t)
+
+	cfg := Config{
+		WrappingSignatures: []string{"github.com/cockroachdb/errors.WithStack"},
+		ModuleName:         "inference",
+	}
+	wrappers, err := InferWrappers(filepath.Join(p, "src", "inference"), cfg, "inference/...")
+	assert.NoError(t, err)
+
+	var got []string
+	for _, w := range wrappers {
+		got = append(got, fmt.Sprintf("%s %s:%d", w.Name, filepath.Base(w.Pos.Filename), w.Pos.Line))
+	}
+	assert.Equal(t, []string{
+		"inference.annotate main.go:46",
+		"inference.annotateTwice main.go:51",
+		"inference/errs.Internal errs.go:17",
+	}, got)
+}
+
+func TestCache(t *testing.T) {
+	gopath := t.TempDir()
+	useGopath(t, gopath)
+
+	write := func(name, src string) {
+		writeGopathPackage(t, gopath, map[string]string{"app/" + name: src})
+	}
+	write("lib/lib.go", `package lib
+
+import "strconv"
+
+func Parse(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	return n, err
+}
+`)
+	write("main.go", `package main
+
+import "app/lib"
+
+func main() { _ = Run() }
+
+func Run() error {
+	_, err := lib.Parse("1")
+	return err
+}
+`)
+
+	cfg := Config{ModuleName: "app"}
+	cache := &driver.Cache{Dir: t.TempDir(), Salt: []byte("test")}
+	analyze := func() map[string]string {
+		pkgs, err := driver.Load(context.Background(), filepath.Join(gopath, "src", "app"), nil, "app/...")
+		assert.NoError(t, err)
+		res, err := cache.Run(context.Background(), NewAnalyzer(cfg), pkgs)
+		assert.NoError(t, err)
+
+		got := map[string]string{}
+		for _, p := range res.Packages {
+			if !strings.HasPrefix(p.Pkg.PkgPath, "app") {
+				continue
+			}
+			out := fmt.Sprintf("cached=%v", p.Cached)
+			for _, d := range p.Diagnostics {
+				pos := res.Fset.Position(d.Pos)
+				out += fmt.Sprintf(" %s:%d:%d %s", filepath.Base(pos.Filename), pos.Line, pos.Column, d.Message)
+			}
+			for _, f := range res.ObjectFacts() {
+				if f.Object.Pkg() == p.Pkg.Types {
+					out += fmt.Sprintf(" %s:%s", f.Object.Name(), f.Fact)
+				}
+			}
+			got[p.Pkg.PkgPath] = out
+		}
+		return got
+	}
+
+	want := map[string]string{
+		"app":     "cached=false main.go:9:9 error returned from external package is not wrapped Run:naked",
+		"app/lib": "cached=false lib.go:7:12 error returned from external package is not wrapped Parse:naked",
+	}
+	assert.Equal(t, want, analyze())
+
+	want = map[string]string{
+		"app":     "cached=true main.go:9:9 error returned from external package is not wrapped Run:naked",
+		"app/lib": "cached=true lib.go:7:12 error returned from external package is not wrapped Parse:naked",
+	}
+	assert.Equal(t, want, analyze())
+
+	// Changing a package invalidates its dependents, but not its
+	// dependencies.
+	write("main.go", `package main
+
+import "app/lib"
+
+func main() { _ = Run() }
+
+// Run parses a number.
+func Run() error {
+	_, err := lib.Parse("1")
+	return err
+}
+`)
+	want["app"] = "cached=false main.go:10:9 error returned from external package is not wrapped Run:naked"
+	assert.Equal(t, want, analyze())
+
+	write("lib/lib.go", `package lib
+
+import "strconv"
+
+// Parse parses a number.
+func Parse(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	return n, err
+}
+`)
+	assert.Equal(t, map[string]string{
+		"app":     "cached=false main.go:10:9 error returned from external package is not wrapped Run:naked",
+		"app/lib": "cached=false lib.go:8:12 error returned from external package is not wrapped Parse:naked",
+	}, analyze())
+}
+
+// writeLargePackage writes a package of a single file made of funcs functions,
+// each of them returning an error through a variable assigned returns times,
+// akin to generated code, and of loads functions returning the error stored
+// in a struct field.
+func writeLargePackage(b *testing.B, gopath string, funcs, returns, loads int) {
+	var sb strings.Builder
+	sb.WriteString("package large\n\nimport \"strconv\"\n")
+	for i := 0; i < funcs; i++ {
+		fmt.Fprintf(&sb, "\nfunc Parse%d(s []string) (int, error) {\n\tvar n int\n\tvar err error\n", i)
+		for j := 0; j < returns; j++ {
+			fmt.Fprintf(&sb, "\tn, err = strconv.Atoi(s[%d])\n\tif err != nil {\n\t\treturn 0, err\n\t}\n", j)
+		}
+		sb.WriteString("\treturn n, nil\n}\n")
+	}
+	sb.WriteString("\ntype State struct {\n\terr error\n}\n\nfunc (s *State) Parse(v string) {\n\t_, s.err = strconv.Atoi(v)\n}\n")
+	for i := 0; i < loads; i++ {
+		fmt.Fprintf(&sb, "\nfunc (s *State) Err%d() error {\n\treturn s.err\n}\n", i)
+	}
+
+	writeGopathPackage(b, gopath, map[string]string{"large/large.go": sb.String()})
+}
+
+func BenchmarkAnalyzer(b *testing.B) {
+	for _, size := range []struct{ funcs, returns, loads int }{{50, 20, 100}, {100, 20, 200}, {200, 20, 400}} {
+		b.Run(fmt.Sprintf("funcs=%d/returns=%d/loads=%d", size.funcs, size.returns, size.loads), func(b *testing.B) {
+			gopath := b.TempDir()
+			useGopath(b, gopath)
+			writeLargePackage(b, gopath, size.funcs, size.returns, size.loads)
+
+			pkgs, err := driver.Load(context.Background(), filepath.Join(gopath, "src", "large"), nil, "large")
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Each run builds its own analyzer, so that nothing is shared
+				// between runs.
+				if _, err := driver.Run(context.Background(), NewAnalyzer(Config{ModuleName: "large"}), pkgs); err != nil {
+					b.Fatal(err)
+				}
+			}
 		})
 	}
 }
+
+func TestParseStubs(t *testing.T) {
+	stubs := stubSet{}
+	err := stubs.parse(strings.NewReader(`
+# comment
+github.com/jackc/pgx/v5.(*Conn).Exec: wrapped
+io.ReadAll: passthrough(arg1)
+`), "test.stubs")
+	assert.NoError(t, err)
+	assert.Equal(t, stubSet{
+		"github.com/jackc/pgx/v5.(*Conn).Exec": {kind: stubWrapped},
+		"io.ReadAll":                           {kind: stubPassthrough, arg: 1},
+	}, stubs)
+
+	err = stubs.parse(strings.NewReader("io.ReadAll: unwrapped"), "test.stubs")
+	assert.EqualError(t, err, `test.stubs:1: unknown behaviour "unwrapped", expected wrapped, naked, sentinel or passthrough(argN)`)
+	err = stubs.parse(strings.NewReader("\nio.ReadAll"), "test.stubs")
+	assert.EqualError(t, err, "test.stubs:2: expected <name>: <behaviour>")
+
+	// The standard library stubs are opt-in.
+	none, err := loadStubs(&Config{})
+	assert.NoError(t, err)
+	assert.Empty(t, none)
+
+	stdlib, err := loadStubs(&Config{StdlibStubs: true})
+	assert.NoError(t, err)
+	assert.Equal(t, stub{kind: stubSentinel}, stdlib["io.EOF"])
+	assert.Equal(t, stub{kind: stubNaked}, stdlib["(*os.File).Close"])
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// goVersionAtLeast returns whether the Go toolchain running the tests is at
+// least of the given version, such as go1.18.
+func goVersionAtLeast(version string) bool {
+	for _, tag := range build.Default.ReleaseTags {
+		if tag == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package errcheckstack
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// isErrorfWrapping returns whether calls to fn should be checked by looking
+// at the operands of their %w verbs.
+func isErrorfWrapping(cfg *Config, fn *types.Func) bool {
+	return cfg.ErrorfWrapping && fn.FullName() == "fmt.Errorf"
+}
+
+// errorfWrapped returns whether a call to fmt.Errorf wraps only errors that
+// are themselves wrapped. A call without any %w verb is always naked, as it
+// creates a brand new error without a stack.
+func errorfWrapped(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) bool {
+	operands := errorfOperands(pass, call)
+	if len(operands) == 0 {
+		return false
+	}
+
+	for _, op := range operands {
+		if !exprWrapped(cfg, pass, op) {
+			return false
+		}
+	}
+	return true
+}
+
+// errorfOperands returns the arguments of a fmt.Errorf call that are consumed
+// by a %w verb. Nothing is returned if the format string is not a constant.
+func errorfOperands(pass *analysis.Pass, call *ast.CallExpr) []ast.Expr {
+	if len(call.Args) < 1 {
+		return nil
+	}
+	tv, ok := pass.TypesInfo.Types[call.Args[0]]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return nil
+	}
+
+	var operands []ast.Expr
+	for _, i := range wrapVerbArgs(constant.StringVal(tv.Value)) {
+		// Operands are following the format string.
+		if i+1 >= len(call.Args) {
+			continue
+		}
+		arg := call.Args[i+1]
+		if !isError(pass.TypesInfo.TypeOf(arg)) {
+			continue
+		}
+		operands = append(operands, arg)
+	}
+	return operands
+}
+
+// wrapVerbArgs parses a format string and returns the indexes of the arguments,
+// starting after the format string itself, that are consumed by a %w verb.
+//
+// It follows the same rules as the fmt package regarding flags, explicit
+// argument indexes and star width and precision.
+func wrapVerbArgs(format string) []int {
+	var indexes []int
+	argNum := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+
+		// Flags.
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+
+		// Width, possibly preceded by an explicit argument index.
+		i, argNum = parseArgIndex(format, i, argNum)
+		if i < len(format) && format[i] == '*' {
+			i++
+			argNum++
+		} else {
+			i = skipDigits(format, i)
+		}
+
+		// Precision.
+		if i < len(format) && format[i] == '.' {
+			i++
+			i, argNum = parseArgIndex(format, i, argNum)
+			if i < len(format) && format[i] == '*' {
+				i++
+				argNum++
+			} else {
+				i = skipDigits(format, i)
+			}
+		}
+
+		// Verb, possibly preceded by an explicit argument index.
+		i, argNum = parseArgIndex(format, i, argNum)
+		if i >= len(format) {
+			break
+		}
+		switch format[i] {
+		case '%':
+			// A literal percent sign doesn't consume any argument.
+			continue
+		case 'w':
+			indexes = append(indexes, argNum)
+		}
+		argNum++
+	}
+
+	return indexes
+}
+
+// parseArgIndex parses an explicit argument index such as [2] at position i,
+// returning the position following it and the zero based argument number it
+// designates. If there is none, i and argNum are returned unchanged.
+func parseArgIndex(format string, i int, argNum int) (int, int) {
+	if i >= len(format) || format[i] != '[' {
+		return i, argNum
+	}
+	end := strings.IndexByte(format[i:], ']')
+	if end < 0 {
+		return i, argNum
+	}
+	n := 0
+	for _, c := range format[i+1 : i+end] {
+		if c < '0' || c > '9' {
+			return i, argNum
+		}
+		n = n*10 + int(c-'0')
+	}
+	if n < 1 {
+		return i, argNum
+	}
+	return i + end + 1, n - 1
+}
+
+func skipDigits(s string, i int) int {
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
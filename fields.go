@@ -0,0 +1,239 @@
+package errcheckstack
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/types/objectpath"
+)
+
+// errorField returns the selector expr is made of, if it loads a struct
+// field of type error.
+func errorField(pass *analysis.Pass, expr ast.Expr) (*ast.SelectorExpr, bool) {
+	sel, ok := astutil.Unparen(expr).(*ast.SelectorExpr)
+	if !ok {
+		return nil, false
+	}
+	selection, ok := pass.TypesInfo.Selections[sel]
+	if !ok || selection.Kind() != types.FieldVal || !isError(selection.Obj().Type()) {
+		return nil, false
+	}
+	return sel, true
+}
+
+// fieldWrapped returns whether the errors loaded from a struct field are
+// wrapped, which is the case when all the errors stored in it are. It also
+// returns the positions of the naked stores made by the package, the paths of
+// the other packages storing naked errors in it, and whether the field status
+// is known at all.
+//
+// Stores made by other packages are known through their facts: the one of the
+// declaring package on the field, and the nakedFieldsFact of the imported
+// packages. Stores made by packages that aren't imported, directly or not,
+// can't be seen.
+func fieldWrapped(cfg *Config, pass *analysis.Pass, sel *ast.SelectorExpr) (wrapped bool, nakedStores []token.Pos, nakedPkgs []string, known bool) {
+	field := pass.TypesInfo.Selections[sel].Obj().(*types.Var)
+
+	index := pass.ResultOf[fieldsAnalyzer].(*fieldIndex)
+	stores := index.stored(field)
+	for _, store := range stores {
+		if !returnedWrapped(cfg, pass, store) {
+			nakedStores = append(nakedStores, store.Pos())
+		}
+	}
+	known = len(stores) > 0
+
+	if field.Pkg() != pass.Pkg {
+		fact := wrapFact{}
+		if pass.ImportObjectFact(field, &fact) {
+			known = true
+			if !fact.isWrapped {
+				nakedPkgs = append(nakedPkgs, field.Pkg().Path())
+			}
+		}
+	}
+	if key, ok := fieldKey(field); ok {
+		if pkgs := importedNakedFields(pass)[key]; len(pkgs) > 0 {
+			known = true
+			nakedPkgs = append(nakedPkgs, pkgs...)
+		}
+	}
+	return known && len(nakedStores) == 0 && len(nakedPkgs) == 0, nakedStores, nakedPkgs, known
+}
+
+// fieldOrigin describes where the naked errors loaded from a field come from.
+// Fields whose stores are unknown aren't reported.
+func fieldOrigin(cfg *Config, pass *analysis.Pass, sel *ast.SelectorExpr) (string, bool) {
+	_, nakedStores, nakedPkgs, known := fieldWrapped(cfg, pass, sel)
+	if !known {
+		return "", false
+	}
+	if len(nakedStores) == 0 {
+		return fmt.Sprintf("loaded from field %s, stored naked by package %s,", types.ExprString(sel), strings.Join(nakedPkgs, ", ")), true
+	}
+
+	var positions []string
+	for _, pos := range nakedStores {
+		p := pass.Fset.Position(pos)
+		positions = append(positions, fmt.Sprintf("%s:%d:%d", filepath.Base(p.Filename), p.Line, p.Column))
+	}
+	return fmt.Sprintf("loaded from field %s (naked stores: %s)", types.ExprString(sel), strings.Join(positions, ", ")), true
+}
+
+// typeUnderlying returns the underlying type of typ, seeing through pointers
+// such as the ones of &T{} composite literals.
+func typeUnderlying(typ types.Type) types.Type {
+	if typ == nil {
+		return nil
+	}
+	if ptr, ok := typ.Underlying().(*types.Pointer); ok {
+		return ptr.Elem().Underlying()
+	}
+	return typ.Underlying()
+}
+
+// exportFieldFacts exports whether the error fields of the struct types
+// declared at the package level are wrapped, so packages loading them know
+// about the stores made in this package.
+func exportFieldFacts(cfg *Config, pass *analysis.Pass) {
+	index := pass.ResultOf[fieldsAnalyzer].(*fieldIndex)
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			field := st.Field(i)
+			if !isError(field.Type()) {
+				continue
+			}
+			stores := index.stored(field)
+			if len(stores) == 0 {
+				continue
+			}
+			wrapped := true
+			for _, store := range stores {
+				if !returnedWrapped(cfg, pass, store) {
+					wrapped = false
+				}
+			}
+			pass.ExportObjectFact(field, &wrapFact{isWrapped: wrapped})
+		}
+	}
+
+	// Facts can't be exported for the fields of other packages, so the ones
+	// the package stores naked errors in are listed in a package fact.
+	naked := map[string]bool{}
+	for field, stores := range index.fields() {
+		if field.Pkg() == pass.Pkg {
+			continue
+		}
+		key, ok := fieldKey(field)
+		if !ok {
+			continue
+		}
+		for _, store := range stores {
+			if !returnedWrapped(cfg, pass, store) {
+				naked[key] = true
+			}
+		}
+	}
+	if len(naked) == 0 {
+		return
+	}
+	fact := &nakedFieldsFact{}
+	for key := range naked {
+		fact.fields = append(fact.fields, key)
+	}
+	sort.Strings(fact.fields)
+	pass.ExportPackageFact(fact)
+}
+
+// nakedFieldsFact lists the error fields declared by other packages in which
+// a package stores naked errors, keyed by fieldKey.
+type nakedFieldsFact struct {
+	fields []string
+}
+
+func (*nakedFieldsFact) AFact() {}
+
+func (f *nakedFieldsFact) String() string {
+	return "naked fields " + strings.Join(f.fields, ", ")
+}
+
+// GobEncode encodes the fact, whose fields are unexported, for drivers
+// serializing facts.
+func (f *nakedFieldsFact) GobEncode() ([]byte, error) {
+	return []byte(strings.Join(f.fields, "\n")), nil
+}
+
+// GobDecode decodes a fact encoded by GobEncode.
+func (f *nakedFieldsFact) GobDecode(b []byte) error {
+	f.fields = strings.Split(string(b), "\n")
+	return nil
+}
+
+// fieldKey identifies a field across packages by the path of its package and
+// its object path, such as "fields/store Store.UF0". Fields that other
+// packages can't reach have no key.
+func fieldKey(field *types.Var) (string, bool) {
+	path, err := objectpath.For(field)
+	if err != nil {
+		return "", false
+	}
+	return field.Pkg().Path() + " " + string(path), true
+}
+
+// importedNakedFields returns the keys of the fields of other packages, see
+// fieldKey, in which the packages imported by the package being analyzed,
+// directly or not, store naked errors, along with the paths of these packages.
+// It is computed once per pass, from the nakedFieldsFact of the imports.
+func importedNakedFields(pass *analysis.Pass) map[string][]string {
+	index := pass.ResultOf[fieldsAnalyzer].(*fieldIndex)
+	if index.nakedPkgs != nil {
+		return index.nakedPkgs
+	}
+	index.nakedPkgs = map[string][]string{}
+	for _, pkg := range importedPackages(pass.Pkg) {
+		fact := nakedFieldsFact{}
+		if !pass.ImportPackageFact(pkg, &fact) {
+			continue
+		}
+		for _, key := range fact.fields {
+			index.nakedPkgs[key] = append(index.nakedPkgs[key], pkg.Path())
+		}
+	}
+	return index.nakedPkgs
+}
+
+// importedPackages returns the packages imported by pkg, directly or not,
+// sorted by path.
+func importedPackages(pkg *types.Package) []*types.Package {
+	seen := map[*types.Package]bool{}
+	var pkgs []*types.Package
+	var visit func(p *types.Package)
+	visit = func(p *types.Package) {
+		for _, imp := range p.Imports() {
+			if !seen[imp] {
+				seen[imp] = true
+				pkgs = append(pkgs, imp)
+				visit(imp)
+			}
+		}
+	}
+	visit(pkg)
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Path() < pkgs[j].Path() })
+	return pkgs
+}
@@ -0,0 +1,20 @@
+module github.com/jhchabran/errcheckstack/golangci
+
+go 1.21
+
+require (
+	github.com/golangci/plugin-module-register v0.1.1
+	github.com/jhchabran/errcheckstack v0.0.0
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/tools v0.18.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/mod v0.16.0 // indirect
+)
+
+// The plugin is developed against the errcheckstack module of this repository.
+replace github.com/jhchabran/errcheckstack => ../
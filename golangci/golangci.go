@@ -0,0 +1,42 @@
+// Package golangci is the module plugin of errcheckstack for golangci-lint,
+// built into a custom golangci-lint binary with golangci-lint custom, see
+// .custom-gcl.example.yml and .golangci.example.yml.
+//
+// Importing it registers the errcheckstack plugin, whose settings use the
+// same keys as the config.yml file of the errcheckstack command.
+package golangci
+
+import (
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/jhchabran/errcheckstack"
+	"golang.org/x/tools/go/analysis"
+)
+
+func init() {
+	register.Plugin("errcheckstack", New)
+}
+
+// plugin is the errcheckstack linter, configured with the settings of
+// .golangci.yml.
+type plugin struct {
+	cfg errcheckstack.Config
+}
+
+// New returns the errcheckstack plugin, configured with the settings of
+// .golangci.yml.
+func New(conf any) (register.LinterPlugin, error) {
+	cfg, err := errcheckstack.DecodeSettings(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin{cfg: cfg}, nil
+}
+
+func (p *plugin) BuildAnalyzers() ([]*analysis.Analyzer, error) {
+	return []*analysis.Analyzer{errcheckstack.NewAnalyzer(p.cfg)}, nil
+}
+
+// GetLoadMode requires type information, which the analyzer relies on.
+func (p *plugin) GetLoadMode() string {
+	return register.LoadModeTypesInfo
+}
@@ -0,0 +1,67 @@
+package golangci
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golangci/plugin-module-register/register"
+	"github.com/jhchabran/errcheckstack"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewExampleConfig(t *testing.T) {
+	b, err := os.ReadFile(".golangci.example.yml")
+	assert.NoError(t, err)
+	var golangci struct {
+		LintersSettings struct {
+			Custom map[string]struct {
+				Type     string      `yaml:"type"`
+				Settings interface{} `yaml:"settings"`
+			} `yaml:"custom"`
+		} `yaml:"linters-settings"`
+	}
+	assert.NoError(t, yaml.Unmarshal(b, &golangci))
+	custom := golangci.LintersSettings.Custom["errcheckstack"]
+	assert.Equal(t, "module", custom.Type)
+
+	cfg, err := errcheckstack.DecodeSettings(custom.Settings)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com/mycorp/app", cfg.ModuleName)
+	assert.True(t, cfg.ErrorfWrapping)
+	assert.True(t, cfg.RuleEnabled("comparison"))
+
+	// golangci-lint looks the plugin up by the name it's registered with.
+	newPlugin, err := register.GetPlugin("errcheckstack")
+	assert.NoError(t, err)
+	p, err := newPlugin(custom.Settings)
+	assert.NoError(t, err)
+	assert.Equal(t, register.LoadModeTypesInfo, p.GetLoadMode())
+
+	analyzers, err := p.BuildAnalyzers()
+	assert.NoError(t, err)
+	assert.Len(t, analyzers, 1)
+	assert.Equal(t, "errcheckstack", analyzers[0].Name)
+}
+
+func TestNewInvalidSettings(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+	_, err = New(map[string]any{"wrappingSignatures": []any{"errors.WithStack"}})
+	assert.Error(t, err)
+	_, err = New(map[string]any{"moduleName": []any{"app"}})
+	assert.Error(t, err)
+	_, err = New(map[string]any{"moduleName": "app", "entrypoints": map[string]any{"enabled": true}})
+	assert.Error(t, err)
+	_, err = New(map[string]any{"moduleName": "app", "rules": map[string]any{"comparison": map[string]any{"severity": "warning"}}})
+	assert.Error(t, err)
+}
+
+func TestPlugin(t *testing.T) {
+	p, err := New(map[string]any{"moduleName": "app"})
+	assert.NoError(t, err)
+	analyzers, err := p.BuildAnalyzers()
+	assert.NoError(t, err)
+	analysistest.Run(t, analysistest.TestData(), analyzers[0], "app")
+}
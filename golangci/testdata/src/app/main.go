@@ -0,0 +1,14 @@
+package main
+
+import (
+	"strconv"
+)
+
+func main() {
+	_ = parse()
+}
+
+func parse() error { // want parse:"naked"
+	_, err := strconv.Atoi("naked")
+	return err // want `error returned from external package is not wrapped`
+}
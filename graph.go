@@ -0,0 +1,190 @@
+package errcheckstack
+
+import (
+	"context"
+	"go/types"
+	"sort"
+
+	"github.com/jhchabran/errcheckstack/internal/driver"
+)
+
+// Wrap statuses of the nodes of a Graph.
+const (
+	StatusWrapped = "wrapped"
+	StatusNaked   = "naked"
+	StatusUnknown = "unknown"
+)
+
+// Graph is the error propagation graph of a module: nodes are functions, and
+// edges link the functions to the callees their returned errors come from.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a function, identified by its full name.
+type GraphNode struct {
+	ID      string `json:"id"`
+	Package string `json:"package"`
+	// Status is the wrapped status of the function, as given by its fact.
+	Status string `json:"status"`
+}
+
+// GraphEdge tells that the errors returned by From come from To.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Wrapped tells whether the errors coming from To are wrapped by the time
+	// From returns them. Naked edges, from a naked function, make the naked
+	// paths of the graph.
+	Wrapped bool `json:"wrapped"`
+}
+
+// ErrorGraph analyzes the packages matching the patterns in dir and returns
+// their error propagation graph. Functions from outside the module appear as
+// the leaves of the graph.
+func ErrorGraph(dir string, cfg Config, patterns ...string) (*Graph, error) {
+	pkgs, err := driver.Load(context.Background(), dir, nil, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := driver.Run(context.Background(), newProgramAnalyzer(cfg), pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{}
+	nodes := map[string]bool{}
+	addNode := func(fn *types.Func) string {
+		id := fn.FullName()
+		if nodes[id] {
+			return id
+		}
+		nodes[id] = true
+		node := GraphNode{ID: id, Status: StatusUnknown}
+		if fn.Pkg() != nil {
+			node.Package = fn.Pkg().Path()
+		}
+		if fact, ok := res.ObjectFact(fn, new(wrapFact)); ok {
+			if fact.(*wrapFact).isWrapped {
+				node.Status = StatusWrapped
+			} else {
+				node.Status = StatusNaked
+			}
+		}
+		g.Nodes = append(g.Nodes, node)
+		return id
+	}
+
+	edges := map[GraphEdge]bool{}
+	for _, p := range res.Packages {
+		r, ok := p.Result.(*Result)
+		if !ok {
+			continue
+		}
+		for fn, summary := range r.Funcs {
+			from := addNode(fn)
+			for _, o := range summary.Origins {
+				if o.Callee == nil {
+					continue
+				}
+				e := GraphEdge{From: from, To: addNode(o.Callee), Wrapped: o.Wrapped}
+				if !edges[e] {
+					edges[e] = true
+					g.Edges = append(g.Edges, e)
+				}
+			}
+		}
+	}
+
+	g.sort()
+	return g, nil
+}
+
+// FilterPackage returns the subgraph made of the functions of the package,
+// along with the callees of these functions.
+func (g *Graph) FilterPackage(pkgPath string) *Graph {
+	keep := map[string]bool{}
+	for _, n := range g.Nodes {
+		if n.Package == pkgPath {
+			keep[n.ID] = true
+		}
+	}
+	sub := &Graph{}
+	for _, e := range g.Edges {
+		if keep[e.From] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	for _, e := range sub.Edges {
+		keep[e.To] = true
+	}
+	for _, n := range g.Nodes {
+		if keep[n.ID] {
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	return sub
+}
+
+// FilterFunc returns the subgraph made of the function, the functions its
+// errors come from and the functions its errors flow to.
+func (g *Graph) FilterFunc(id string) *Graph {
+	down := map[string][]GraphEdge{}
+	up := map[string][]GraphEdge{}
+	for _, e := range g.Edges {
+		down[e.From] = append(down[e.From], e)
+		up[e.To] = append(up[e.To], e)
+	}
+
+	keep := map[string]bool{id: true}
+	kept := map[GraphEdge]bool{}
+	walk := func(adj map[string][]GraphEdge, next func(GraphEdge) string) {
+		queue := []string{id}
+		seen := map[string]bool{id: true}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for _, e := range adj[cur] {
+				kept[e] = true
+				n := next(e)
+				keep[n] = true
+				if !seen[n] {
+					seen[n] = true
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+	walk(down, func(e GraphEdge) string { return e.To })
+	walk(up, func(e GraphEdge) string { return e.From })
+
+	sub := &Graph{}
+	for _, n := range g.Nodes {
+		if keep[n.ID] {
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if kept[e] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	return sub
+}
+
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return !a.Wrapped && b.Wrapped
+	})
+}
@@ -0,0 +1,331 @@
+package errcheckstack
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// assignsAnalyzer provides the index of the assignments to the error variables
+// of a package, so that tracing an error returned through a variable doesn't
+// require walking the files again for every returned identifier.
+var assignsAnalyzer = &analysis.Analyzer{
+	Name:     "errcheckstackassigns",
+	Doc:      "Indexes the assignments to the error variables of a package",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		return &assignIndex{pass: pass}, nil
+	},
+	ResultType: reflect.TypeOf(new(assignIndex)),
+}
+
+// assignIndex maps error variables to the assignments to them. It is built on
+// first use, in a single traversal of the assignments, so that packages whose
+// errors are never traced, such as the ones outside the module, cost nothing.
+type assignIndex struct {
+	pass    *analysis.Pass
+	built   bool
+	assigns map[*types.Var][]*ast.AssignStmt
+	// indirect are the error variables assigned other than by an assignment
+	// statement: by a range clause, or through their address.
+	indirect map[*types.Var]bool
+}
+
+// assignments returns the assignments to the error variable ident refers to,
+// in source order.
+func (x *assignIndex) assignments(ident *ast.Ident) []*ast.AssignStmt {
+	v, ok := x.pass.TypesInfo.ObjectOf(ident).(*types.Var)
+	if !ok {
+		return nil
+	}
+	x.build()
+	return x.assigns[v]
+}
+
+// isAssignedIndirectly returns whether the error variable ident refers to is
+// the key or value of a range clause, or has its address taken, which the
+// assignments don't account for.
+func (x *assignIndex) isAssignedIndirectly(ident *ast.Ident) bool {
+	v, ok := x.pass.TypesInfo.ObjectOf(ident).(*types.Var)
+	if !ok {
+		return false
+	}
+	x.build()
+	return x.indirect[v]
+}
+
+func (x *assignIndex) build() {
+	if x.built {
+		return
+	}
+	x.built = true
+	x.assigns = map[*types.Var][]*ast.AssignStmt{}
+	x.indirect = map[*types.Var]bool{}
+
+	errorVar := func(expr ast.Expr) *types.Var {
+		ident, ok := astutil.Unparen(expr).(*ast.Ident)
+		if !ok || !isError(x.pass.TypesInfo.TypeOf(ident)) {
+			return nil
+		}
+		v, _ := x.pass.TypesInfo.ObjectOf(ident).(*types.Var)
+		return v
+	}
+	ins := x.pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ins.Preorder([]ast.Node{(*ast.AssignStmt)(nil), (*ast.RangeStmt)(nil), (*ast.UnaryExpr)(nil)}, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if _, ok := lhs.(*ast.Ident); !ok {
+					continue
+				}
+				if v := errorVar(lhs); v != nil {
+					x.assigns[v] = append(x.assigns[v], n)
+				}
+			}
+		case *ast.RangeStmt:
+			for _, expr := range []ast.Expr{n.Key, n.Value} {
+				if v := errorVar(expr); v != nil {
+					x.indirect[v] = true
+				}
+			}
+		case *ast.UnaryExpr:
+			if v := errorVar(n.X); v != nil && n.Op == token.AND {
+				x.indirect[v] = true
+			}
+		}
+	})
+	// Files are traversed in the order of the package, which isn't
+	// necessarily the one of their positions.
+	for _, assigns := range x.assigns {
+		sort.Slice(assigns, func(i, j int) bool { return assigns[i].Pos() < assigns[j].Pos() })
+	}
+}
+
+// syncAnalyzer provides the index of the channel sends and errgroup.Group.Go
+// calls of a package, so that tracing the errors received from a channel or
+// returned by errgroup.Group.Wait doesn't require walking the files again for
+// every receive or wait.
+var syncAnalyzer = &analysis.Analyzer{
+	Name:     "errcheckstacksync",
+	Doc:      "Indexes the channel sends and errgroup.Group.Go calls of a package",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		return &syncIndex{pass: pass}, nil
+	},
+	ResultType: reflect.TypeOf(new(syncIndex)),
+}
+
+// syncIndex maps the channels to the values sent on them, and the errgroup
+// groups to the functions passed to their Go method and to the calls to their
+// Wait method. Both are identified by the variable or field holding them. The
+// index is built on first use, in a single traversal, so that packages whose
+// errors are never traced cost nothing.
+type syncIndex struct {
+	pass  *analysis.Pass
+	built bool
+	sends map[types.Object][]ast.Expr
+	funcs map[types.Object][]ast.Expr
+	waits map[types.Object][]waitCall
+	// groups are the groups the function literals are passed to Go on.
+	groups map[*ast.FuncLit]types.Object
+	// flows caches whether the error of any Wait on a group flows to a return
+	// or a sink, see groupWaitFlows.
+	flows map[types.Object]bool
+}
+
+// waitCall is a call to errgroup.Group.Wait, along with the node using its
+// result and the function it is made in.
+type waitCall struct {
+	call   *ast.CallExpr
+	parent ast.Node
+	body   *ast.BlockStmt
+}
+
+// sent returns the values sent on the channel ch, in source order.
+func (x *syncIndex) sent(ch types.Object) []ast.Expr {
+	x.build()
+	return x.sends[ch]
+}
+
+// started returns the functions passed to Go on the group, in source order.
+func (x *syncIndex) started(group types.Object) []ast.Expr {
+	x.build()
+	return x.funcs[group]
+}
+
+// waited returns the calls to Wait on the group, in source order.
+func (x *syncIndex) waited(group types.Object) []waitCall {
+	x.build()
+	return x.waits[group]
+}
+
+// startedOn returns the group lit is passed to Go on, if any.
+func (x *syncIndex) startedOn(lit *ast.FuncLit) (types.Object, bool) {
+	x.build()
+	group, ok := x.groups[lit]
+	return group, ok
+}
+
+func (x *syncIndex) build() {
+	if x.built {
+		return
+	}
+	x.built = true
+	x.sends = map[types.Object][]ast.Expr{}
+	x.funcs = map[types.Object][]ast.Expr{}
+	x.waits = map[types.Object][]waitCall{}
+	x.groups = map[*ast.FuncLit]types.Object{}
+	x.flows = map[types.Object]bool{}
+
+	ins := x.pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ins.WithStack([]ast.Node{(*ast.SendStmt)(nil), (*ast.CallExpr)(nil)}, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.SendStmt:
+			if ch := varOf(x.pass, n.Chan); ch != nil {
+				x.sends[ch] = append(x.sends[ch], n.Value)
+			}
+		case *ast.CallExpr:
+			fn := extractFunc(x.pass.TypesInfo, n.Fun)
+			if fn == nil {
+				return true
+			}
+			switch fn.FullName() {
+			case errgroupGo:
+				if len(n.Args) != 1 {
+					return true
+				}
+				group := varOf(x.pass, n.Fun.(*ast.SelectorExpr).X)
+				if lit, ok := astutil.Unparen(n.Args[0]).(*ast.FuncLit); ok {
+					x.groups[lit] = group
+				}
+				if group != nil {
+					x.funcs[group] = append(x.funcs[group], n.Args[0])
+				}
+			case errgroupWait:
+				group := varOf(x.pass, n.Fun.(*ast.SelectorExpr).X)
+				if group == nil {
+					return true
+				}
+				w := waitCall{call: n, body: enclosingBody(stack)}
+				for i := len(stack) - 2; i >= 0; i-- {
+					if _, ok := stack[i].(*ast.ParenExpr); !ok {
+						w.parent = stack[i]
+						break
+					}
+				}
+				x.waits[group] = append(x.waits[group], w)
+			}
+		}
+		return true
+	})
+}
+
+// enclosingBody returns the body of the innermost function enclosing the last
+// node of the stack, if any.
+func enclosingBody(stack []ast.Node) *ast.BlockStmt {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch n := stack[i].(type) {
+		case *ast.FuncLit:
+			return n.Body
+		case *ast.FuncDecl:
+			return n.Body
+		}
+	}
+	return nil
+}
+
+// fieldsAnalyzer provides the index of the errors stored in struct fields by a
+// package, so that loading a field doesn't require walking the files again.
+var fieldsAnalyzer = &analysis.Analyzer{
+	Name:     "errcheckstackfields",
+	Doc:      "Indexes the errors stored in struct fields by a package",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		return &fieldIndex{pass: pass}, nil
+	},
+	ResultType: reflect.TypeOf(new(fieldIndex)),
+}
+
+// fieldIndex maps the error fields, whichever package declares them, to the
+// values the package stores in them, either through assignments or composite
+// literals. It is built on first use, in a single traversal, so that packages
+// whose errors are never traced cost nothing.
+type fieldIndex struct {
+	pass   *analysis.Pass
+	built  bool
+	stores map[*types.Var][]ast.Expr
+	// nakedPkgs maps the keys of the fields of other packages, see fieldKey,
+	// to the imported packages storing naked errors in them. It is filled
+	// from the facts of the analyzer, see importedNakedFields.
+	nakedPkgs map[string][]string
+}
+
+// stored returns the values stored in the error field, in source order.
+func (x *fieldIndex) stored(field *types.Var) []ast.Expr {
+	x.build()
+	return x.stores[field]
+}
+
+// fields returns the error fields the package stores values in.
+func (x *fieldIndex) fields() map[*types.Var][]ast.Expr {
+	x.build()
+	return x.stores
+}
+
+func (x *fieldIndex) build() {
+	if x.built {
+		return
+	}
+	x.built = true
+	x.stores = map[*types.Var][]ast.Expr{}
+
+	add := func(obj types.Object, value ast.Expr) {
+		if field, ok := obj.(*types.Var); ok && field.IsField() && isError(field.Type()) {
+			x.stores[field] = append(x.stores[field], value)
+		}
+	}
+	ins := x.pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ins.Preorder([]ast.Node{(*ast.AssignStmt)(nil), (*ast.CompositeLit)(nil)}, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				sel, ok := astutil.Unparen(lhs).(*ast.SelectorExpr)
+				if !ok {
+					continue
+				}
+				if len(n.Lhs) == len(n.Rhs) {
+					add(x.pass.TypesInfo.ObjectOf(sel.Sel), n.Rhs[i])
+				} else {
+					// The field is assigned one of the values returned by a call.
+					add(x.pass.TypesInfo.ObjectOf(sel.Sel), n.Rhs[0])
+				}
+			}
+		case *ast.CompositeLit:
+			st, ok := typeUnderlying(x.pass.TypesInfo.TypeOf(n)).(*types.Struct)
+			if !ok {
+				return
+			}
+			for i, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						add(x.pass.TypesInfo.ObjectOf(key), kv.Value)
+					}
+					continue
+				}
+				if i < st.NumFields() {
+					add(st.Field(i), elt)
+				}
+			}
+		}
+	})
+}
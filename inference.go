@@ -0,0 +1,214 @@
+package errcheckstack
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/jhchabran/errcheckstack/internal/driver"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// stackCapture is the function capturing stack traces that hand-written
+// wrappers call.
+const stackCapture = "runtime.Callers"
+
+// inferWrappers exports a wrapperFact for the functions of the package that
+// wrap an error argument, i.e. whose returned errors are all either nil or
+// built from that argument by:
+//
+//   - calling a wrapping function, such as a configured wrapping signature or
+//     another wrapper.
+//   - building an error value from it that holds a stack trace captured by
+//     runtime.Callers, such as &withStack{err: err, stack: stack[:n]}.
+//
+// Returning the argument as is on any path disqualifies the function.
+//
+// Wrappers can call each other, so inference runs until no more wrapper is
+// found.
+func inferWrappers(cfg *Config, pass *analysis.Pass) {
+	var candidates []*ast.FuncDecl
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			fdecl, ok := decl.(*ast.FuncDecl)
+			if ok && fdecl.Body != nil && !hasDirective(fdecl, directiveWrapper) {
+				candidates = append(candidates, fdecl)
+			}
+		}
+	}
+
+	for found := true; found; {
+		found = false
+		for i, fdecl := range candidates {
+			if fdecl == nil {
+				continue
+			}
+			fn, ok := pass.TypesInfo.Defs[fdecl.Name].(*types.Func)
+			if !ok || !isInferredWrapper(cfg, pass, fn, fdecl) {
+				continue
+			}
+			pass.ExportObjectFact(fn, &wrapperFact{inferred: true})
+			candidates[i] = nil
+			found = true
+		}
+	}
+}
+
+// isInferredWrapper returns whether fn, declared by fdecl, wraps one of its
+// error arguments.
+func isInferredWrapper(cfg *Config, pass *analysis.Pass, fn *types.Func, fdecl *ast.FuncDecl) bool {
+	params := map[types.Object]bool{}
+	for _, field := range fdecl.Type.Params.List {
+		for _, name := range field.Names {
+			if obj := pass.TypesInfo.Defs[name]; obj != nil && isError(obj.Type()) {
+				params[obj] = true
+			}
+		}
+	}
+	if len(params) == 0 {
+		return false
+	}
+
+	stack := stackVars(pass, fdecl.Body)
+
+	results := fn.Type().(*types.Signature).Results()
+	wraps, ok := 0, true
+	ast.Inspect(fdecl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			// Function literals return to their own callers.
+			return false
+		case *ast.ReturnStmt:
+			if len(n.Results) != results.Len() {
+				// Naked returns and calls returning multiple values.
+				ok = false
+				return false
+			}
+			for i, res := range n.Results {
+				if !isError(results.At(i).Type()) || pass.TypesInfo.Types[res].IsNil() {
+					continue
+				}
+				if !refersTo(pass, res, params) {
+					ok = false
+					continue
+				}
+				if call, isCall := res.(*ast.CallExpr); isCall {
+					if callee := calledFunc(pass, call); callee != nil && isWrapper(cfg, pass, callee) {
+						wraps++
+						continue
+					}
+				}
+				if holdsStack(pass, res, stack) {
+					wraps++
+					continue
+				}
+				ok = false
+			}
+		}
+		return true
+	})
+	return ok && wraps > 0
+}
+
+// stackVars returns the variables holding a stack trace captured within body,
+// which are the buffers given to runtime.Callers and the counts it returns.
+func stackVars(pass *analysis.Pass, body *ast.BlockStmt) map[types.Object]bool {
+	vars := map[types.Object]bool{}
+	isCapture := func(expr ast.Expr) (*ast.CallExpr, bool) {
+		call, ok := astutil.Unparen(expr).(*ast.CallExpr)
+		if !ok {
+			return nil, false
+		}
+		fn := calledFunc(pass, call)
+		return call, fn != nil && fn.FullName() == stackCapture
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Rhs) != 1 {
+				return true
+			}
+			if _, ok := isCapture(n.Rhs[0]); ok {
+				for _, lhs := range n.Lhs {
+					if obj := varOf(pass, lhs); obj != nil {
+						vars[obj] = true
+					}
+				}
+			}
+		case *ast.CallExpr:
+			if call, ok := isCapture(n); ok && len(call.Args) == 2 {
+				if obj := varOf(pass, call.Args[1]); obj != nil {
+					vars[obj] = true
+				}
+			}
+		}
+		return true
+	})
+	return vars
+}
+
+// holdsStack returns whether expr builds a value holding a captured stack
+// trace, such as &withStack{err: err, stack: stack[:n]}.
+func holdsStack(pass *analysis.Pass, expr ast.Expr, stack map[types.Object]bool) bool {
+	expr = astutil.Unparen(expr)
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		expr = astutil.Unparen(u.X)
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	return ok && len(stack) > 0 && refersTo(pass, lit, stack)
+}
+
+// refersTo returns whether expr refers to one of the objects.
+func refersTo(pass *analysis.Pass, expr ast.Expr, objs map[types.Object]bool) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && objs[pass.TypesInfo.Uses[ident]] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// InferredWrapper is a function of the module inferred to be a wrapper.
+type InferredWrapper struct {
+	// Name is the full name of the function, as expected by
+	// Config.WrappingSignatures.
+	Name string
+	Pos  token.Position
+}
+
+// InferWrappers analyzes the packages matching the patterns in dir with
+// wrapper inference enabled, and returns the wrappers inferred in the module,
+// for them to be reviewed and added to the configuration.
+func InferWrappers(dir string, cfg Config, patterns ...string) ([]InferredWrapper, error) {
+	cfg.InferWrappers = true
+	pkgs, err := driver.Load(context.Background(), dir, nil, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := driver.Run(context.Background(), newProgramAnalyzer(cfg), pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrappers []InferredWrapper
+	for _, f := range res.ObjectFacts() {
+		fact, ok := f.Fact.(*wrapperFact)
+		if !ok || !fact.inferred {
+			continue
+		}
+		fn, ok := f.Object.(*types.Func)
+		if !ok || isTrusted(&cfg, fn.Pkg().Path()) {
+			continue
+		}
+		wrappers = append(wrappers, InferredWrapper{Name: fn.FullName(), Pos: res.Fset.Position(fn.Pos())})
+	}
+	sort.Slice(wrappers, func(i, j int) bool {
+		return wrappers[i].Name < wrappers[j].Name
+	})
+	return wrappers, nil
+}
@@ -0,0 +1,316 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/objectpath"
+)
+
+// cacheVersion is bumped whenever the format of the cache entries changes.
+const cacheVersion = "1"
+
+// Cache stores on disk the facts and diagnostics of the packages analyzed by
+// Run, so that later runs skip the packages that didn't change.
+//
+// Entries are addressed by the hash of the analyzer name, the salt, the source
+// files of the package and the keys of its dependencies. A change to a package
+// thus invalidates the entries of all its dependents, which subsumes keying
+// them by the export data of their dependencies.
+//
+// Packages restored from the cache have no result, and the analyzers their
+// analyzer requires aren't run on them. Hence the cache is only used when none
+// of the required analyzers exports facts, and by callers that only need
+// diagnostics and facts. Failing to read or write an entry is never an error,
+// the package is analyzed instead.
+type Cache struct {
+	// Dir is the directory holding the entries, created if needed.
+	Dir string
+	// Salt must change whenever the outcome of the analyzer may change for
+	// the same sources, such as when its configuration changes.
+	Salt []byte
+}
+
+// Run is like the Run function, but reuses the entries of the cache and
+// stores the ones of the analyzed packages.
+func (c *Cache) Run(ctx context.Context, a *analysis.Analyzer, pkgs []*packages.Package) (*Result, error) {
+	if requiresFacts(a) {
+		return Run(ctx, a, pkgs)
+	}
+	return run(ctx, a, pkgs, c)
+}
+
+// requiresFacts returns whether one of the analyzers a requires, directly or
+// not, exports facts.
+func requiresFacts(a *analysis.Analyzer) bool {
+	for _, req := range a.Requires {
+		if len(req.FactTypes) > 0 || requiresFacts(req) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheEntry is the outcome of analyzing a package.
+type cacheEntry struct {
+	ObjectFacts  []cachedFact
+	PackageFacts []cachedFact
+	Diagnostics  []cachedDiagnostic
+}
+
+// cachedFact is a gob encoded fact. Path is the path of the object of object
+// facts, within the package.
+type cachedFact struct {
+	Path objectpath.Path
+	Type string
+	Data []byte
+}
+
+type cachedPosition struct {
+	Filename string
+	Offset   int
+}
+
+type cachedDiagnostic struct {
+	Pos, End cachedPosition
+	Category string
+	Message  string
+	Related  []cachedRelated
+	Fixes    []cachedFix
+}
+
+type cachedRelated struct {
+	Pos, End cachedPosition
+	Message  string
+}
+
+type cachedFix struct {
+	Message string
+	Edits   []cachedEdit
+}
+
+type cachedEdit struct {
+	Pos, End cachedPosition
+	NewText  []byte
+}
+
+// keys computes the cache key of every package, given in dependency order.
+func (c *Cache) keys(a *analysis.Analyzer, order []*packages.Package) (map[*packages.Package]string, error) {
+	keys := map[*packages.Package]string{}
+	for _, pkg := range order {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s %s %s\n", cacheVersion, runtime.Version(), a.Name, pkg.ID)
+		h.Write(c.Salt)
+
+		for _, name := range pkg.CompiledGoFiles {
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(h, "\nfile %s\n", name)
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var imports []string
+		for path := range pkg.Imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		for _, path := range imports {
+			fmt.Fprintf(h, "\nimport %s %s\n", path, keys[pkg.Imports[path]])
+		}
+		keys[pkg] = hex.EncodeToString(h.Sum(nil))
+	}
+	return keys, nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+func (c *Cache) load(key string) (*cacheEntry, bool) {
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// store writes the entry atomically, so that concurrent runs never read a
+// partial entry.
+func (c *Cache) store(key string, e *cacheEntry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// encodeEntry encodes the facts exported and the diagnostics reported while
+// analyzing pkg. Like go vet, it drops the facts of the objects that other
+// packages can't reach, such as unexported functions, since only dependents
+// import facts from cached packages.
+func encodeEntry(pkg *packages.Package, facts map[factKey]analysis.Fact, diags []analysis.Diagnostic) (*cacheEntry, error) {
+	e := &cacheEntry{}
+	for k, f := range facts {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(f); err != nil {
+			return nil, err
+		}
+		cf := cachedFact{Type: k.typ.String(), Data: buf.Bytes()}
+		if k.obj == nil {
+			e.PackageFacts = append(e.PackageFacts, cf)
+			continue
+		}
+		path, err := objectpath.For(k.obj)
+		if err != nil {
+			continue
+		}
+		cf.Path = path
+		e.ObjectFacts = append(e.ObjectFacts, cf)
+	}
+
+	pos := func(p token.Pos) cachedPosition {
+		if !p.IsValid() {
+			return cachedPosition{}
+		}
+		position := pkg.Fset.Position(p)
+		return cachedPosition{Filename: position.Filename, Offset: position.Offset}
+	}
+	for _, d := range diags {
+		cd := cachedDiagnostic{Pos: pos(d.Pos), End: pos(d.End), Category: d.Category, Message: d.Message}
+		for _, r := range d.Related {
+			cd.Related = append(cd.Related, cachedRelated{Pos: pos(r.Pos), End: pos(r.End), Message: r.Message})
+		}
+		for _, sf := range d.SuggestedFixes {
+			fix := cachedFix{Message: sf.Message}
+			for _, te := range sf.TextEdits {
+				fix.Edits = append(fix.Edits, cachedEdit{Pos: pos(te.Pos), End: pos(te.End), NewText: te.NewText})
+			}
+			cd.Fixes = append(cd.Fixes, fix)
+		}
+		e.Diagnostics = append(e.Diagnostics, cd)
+	}
+	return e, nil
+}
+
+// decodeEntry restores the facts of the entry into facts, and returns its
+// diagnostics.
+func decodeEntry(a *analysis.Analyzer, pkg *packages.Package, files map[string]*token.File, e *cacheEntry, facts map[factKey]analysis.Fact) ([]analysis.Diagnostic, error) {
+	factTypes := map[string]reflect.Type{}
+	for _, f := range a.FactTypes {
+		factTypes[reflect.TypeOf(f).String()] = reflect.TypeOf(f)
+	}
+	decodeFact := func(cf cachedFact) (reflect.Type, analysis.Fact, error) {
+		typ, ok := factTypes[cf.Type]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown fact type %s", cf.Type)
+		}
+		v := reflect.New(typ.Elem())
+		if err := gob.NewDecoder(bytes.NewReader(cf.Data)).DecodeValue(v); err != nil {
+			return nil, nil, err
+		}
+		return typ, v.Interface().(analysis.Fact), nil
+	}
+
+	restored := map[factKey]analysis.Fact{}
+	for _, cf := range e.ObjectFacts {
+		obj, err := objectpath.Object(pkg.Types, cf.Path)
+		if err != nil {
+			return nil, err
+		}
+		typ, f, err := decodeFact(cf)
+		if err != nil {
+			return nil, err
+		}
+		restored[factKey{obj: obj, typ: typ}] = f
+	}
+	for _, cf := range e.PackageFacts {
+		typ, f, err := decodeFact(cf)
+		if err != nil {
+			return nil, err
+		}
+		restored[factKey{pkg: pkg.Types, typ: typ}] = f
+	}
+
+	var err error
+	pos := func(p cachedPosition) token.Pos {
+		if p.Filename == "" {
+			return token.NoPos
+		}
+		f, ok := files[p.Filename]
+		if !ok || p.Offset > f.Size() {
+			err = fmt.Errorf("unknown position %s:#%d", p.Filename, p.Offset)
+			return token.NoPos
+		}
+		return f.Pos(p.Offset)
+	}
+	var diags []analysis.Diagnostic
+	for _, cd := range e.Diagnostics {
+		d := analysis.Diagnostic{Pos: pos(cd.Pos), End: pos(cd.End), Category: cd.Category, Message: cd.Message}
+		for _, r := range cd.Related {
+			d.Related = append(d.Related, analysis.RelatedInformation{Pos: pos(r.Pos), End: pos(r.End), Message: r.Message})
+		}
+		for _, fix := range cd.Fixes {
+			sf := analysis.SuggestedFix{Message: fix.Message}
+			for _, te := range fix.Edits {
+				sf.TextEdits = append(sf.TextEdits, analysis.TextEdit{Pos: pos(te.Pos), End: pos(te.End), NewText: te.NewText})
+			}
+			d.SuggestedFixes = append(d.SuggestedFixes, sf)
+		}
+		diags = append(diags, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for k, f := range restored {
+		facts[k] = f
+	}
+	return diags, nil
+}
+
+// fileIndex indexes the files of fset by name.
+func fileIndex(fset *token.FileSet) map[string]*token.File {
+	files := map[string]*token.File{}
+	fset.Iterate(func(f *token.File) bool {
+		files[f.Name()] = f
+		return true
+	})
+	return files
+}
@@ -0,0 +1,296 @@
+// Package driver runs an analyzer over a whole program loaded with
+// golang.org/x/tools/go/packages, keeping the diagnostics and results in memory
+// instead of printing them like the singlechecker does.
+package driver
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+// LoadMode is the mode packages must be loaded with to be analyzed.
+const LoadMode = packages.LoadAllSyntax
+
+// Load loads the packages matching the patterns in dir, along with all their
+// dependencies, so that they can be analyzed. env is appended to the
+// environment of the underlying build tool.
+func Load(ctx context.Context, dir string, env []string, patterns ...string) ([]*packages.Package, error) {
+	conf := &packages.Config{
+		Context: ctx,
+		Mode:    LoadMode,
+		Dir:     dir,
+	}
+	if len(env) > 0 {
+		conf.Env = env
+	}
+	pkgs, err := packages.Load(conf, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []packages.Error
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		errs = append(errs, pkg.Errors...)
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to load packages: %v", errs[0])
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages matching %v", patterns)
+	}
+	return pkgs, nil
+}
+
+// Package holds the outcome of running an analyzer on a single package.
+type Package struct {
+	Pkg         *packages.Package
+	Diagnostics []analysis.Diagnostic
+	Result      interface{}
+	// Cached tells whether the package was restored from a Cache, in which
+	// case it has no result.
+	Cached bool
+}
+
+// Result holds the outcome of running an analyzer on a whole program.
+type Result struct {
+	Fset *token.FileSet
+	// Packages holds the outcome for each package, in dependency order.
+	Packages []*Package
+
+	facts map[factKey]analysis.Fact
+}
+
+// ObjectFact returns the fact of the given type exported for obj, if any.
+func (r *Result) ObjectFact(obj types.Object, typ analysis.Fact) (analysis.Fact, bool) {
+	f, ok := r.facts[factKey{obj: obj, typ: reflect.TypeOf(typ)}]
+	return f, ok
+}
+
+// ObjectFacts returns all the object facts exported during the analysis.
+func (r *Result) ObjectFacts() []analysis.ObjectFact {
+	var facts []analysis.ObjectFact
+	for k, f := range r.facts {
+		if k.obj != nil {
+			facts = append(facts, analysis.ObjectFact{Object: k.obj, Fact: f})
+		}
+	}
+	sort.Slice(facts, func(i, j int) bool {
+		return facts[i].Object.Pos() < facts[j].Object.Pos()
+	})
+	return facts
+}
+
+// factKey identifies a fact, either attached to an object or to a package.
+type factKey struct {
+	obj types.Object
+	pkg *types.Package
+	typ reflect.Type
+}
+
+// Run runs the analyzer, and the analyzers it requires, on the packages and
+// all their dependencies, in dependency order so that facts flow from
+// dependencies to their dependents.
+//
+// Since all packages are loaded from source in a single program, facts are kept
+// in memory and never serialized. Cancelling ctx stops the analysis before the
+// next package.
+func Run(ctx context.Context, a *analysis.Analyzer, pkgs []*packages.Package) (*Result, error) {
+	return run(ctx, a, pkgs, nil)
+}
+
+func run(ctx context.Context, a *analysis.Analyzer, pkgs []*packages.Package, cache *Cache) (*Result, error) {
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages to analyze")
+	}
+
+	r := &runner{
+		facts:   map[factKey]analysis.Fact{},
+		actions: map[actionKey]*action{},
+		cache:   cache,
+		root:    a,
+	}
+
+	var order []*packages.Package
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		order = append(order, pkg)
+	})
+	if cache != nil {
+		var err error
+		r.keys, err = cache.keys(a, order)
+		if err != nil {
+			return nil, err
+		}
+		r.files = fileIndex(pkgs[0].Fset)
+	}
+
+	res := &Result{Fset: pkgs[0].Fset, facts: r.facts}
+	for _, pkg := range order {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		act, err := r.run(a, pkg)
+		if err != nil {
+			return nil, err
+		}
+		res.Packages = append(res.Packages, &Package{
+			Pkg:         pkg,
+			Diagnostics: act.diagnostics,
+			Result:      act.result,
+			Cached:      act.cached,
+		})
+	}
+	return res, nil
+}
+
+type actionKey struct {
+	a   *analysis.Analyzer
+	pkg *packages.Package
+}
+
+type action struct {
+	diagnostics []analysis.Diagnostic
+	result      interface{}
+	err         error
+	cached      bool
+	// exported holds the facts exported by the action, to be cached.
+	exported map[factKey]analysis.Fact
+}
+
+type runner struct {
+	facts   map[factKey]analysis.Fact
+	actions map[actionKey]*action
+
+	// cache is nil unless the analysis is cached, in which case keys holds
+	// the key of every package and files indexes the files by name. Only the
+	// actions of the root analyzer are cached.
+	cache *Cache
+	root  *analysis.Analyzer
+	keys  map[*packages.Package]string
+	files map[string]*token.File
+}
+
+// run runs the analyzer on a single package, once its requirements have been
+// run. Dependencies of pkg must have been run beforehand for facts to be
+// available.
+func (r *runner) run(a *analysis.Analyzer, pkg *packages.Package) (*action, error) {
+	key := actionKey{a: a, pkg: pkg}
+	if act, ok := r.actions[key]; ok {
+		return act, act.err
+	}
+	act := &action{exported: map[factKey]analysis.Fact{}}
+	r.actions[key] = act
+
+	if r.cache != nil && a == r.root {
+		if e, ok := r.cache.load(r.keys[pkg]); ok {
+			if diags, err := decodeEntry(a, pkg, r.files, e, r.facts); err == nil {
+				act.diagnostics = diags
+				act.cached = true
+				return act, nil
+			}
+		}
+	}
+
+	resultOf := map[*analysis.Analyzer]interface{}{}
+	for _, req := range a.Requires {
+		reqAct, err := r.run(req, pkg)
+		if err != nil {
+			act.err = err
+			return act, err
+		}
+		resultOf[req] = reqAct.result
+	}
+
+	factTypes := map[reflect.Type]bool{}
+	for _, f := range a.FactTypes {
+		factTypes[reflect.TypeOf(f)] = true
+	}
+
+	pass := &analysis.Pass{
+		Analyzer:   a,
+		Fset:       pkg.Fset,
+		Files:      pkg.Syntax,
+		OtherFiles: pkg.OtherFiles,
+		Pkg:        pkg.Types,
+		TypesInfo:  pkg.TypesInfo,
+		TypesSizes: pkg.TypesSizes,
+		ResultOf:   resultOf,
+		Report: func(d analysis.Diagnostic) {
+			act.diagnostics = append(act.diagnostics, d)
+		},
+		ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+			return r.importFact(factKey{obj: obj, typ: reflect.TypeOf(fact)}, fact)
+		},
+		ImportPackageFact: func(p *types.Package, fact analysis.Fact) bool {
+			return r.importFact(factKey{pkg: p, typ: reflect.TypeOf(fact)}, fact)
+		},
+		ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+			if obj.Pkg() != pkg.Types {
+				panic(fmt.Sprintf("%s: exporting a fact for %s, which does not belong to %s", a.Name, obj, pkg.Types.Path()))
+			}
+			if !factTypes[reflect.TypeOf(fact)] {
+				panic(fmt.Sprintf("%s: fact type %T is not declared", a.Name, fact))
+			}
+			k := factKey{obj: obj, typ: reflect.TypeOf(fact)}
+			r.facts[k] = fact
+			act.exported[k] = fact
+		},
+		ExportPackageFact: func(fact analysis.Fact) {
+			if !factTypes[reflect.TypeOf(fact)] {
+				panic(fmt.Sprintf("%s: fact type %T is not declared", a.Name, fact))
+			}
+			k := factKey{pkg: pkg.Types, typ: reflect.TypeOf(fact)}
+			r.facts[k] = fact
+			act.exported[k] = fact
+		},
+		AllObjectFacts: func() []analysis.ObjectFact {
+			var facts []analysis.ObjectFact
+			for k, f := range r.facts {
+				if k.obj != nil && factTypes[k.typ] {
+					facts = append(facts, analysis.ObjectFact{Object: k.obj, Fact: f})
+				}
+			}
+			return facts
+		},
+		AllPackageFacts: func() []analysis.PackageFact {
+			var facts []analysis.PackageFact
+			for k, f := range r.facts {
+				if k.pkg != nil && factTypes[k.typ] {
+					facts = append(facts, analysis.PackageFact{Package: k.pkg, Fact: f})
+				}
+			}
+			return facts
+		},
+	}
+
+	result, err := a.Run(pass)
+	if err != nil {
+		act.err = fmt.Errorf("%s: analyzing %s: %w", a.Name, pkg.PkgPath, err)
+		return act, act.err
+	}
+	act.result = result
+
+	if r.cache != nil && a == r.root {
+		if e, err := encodeEntry(pkg, act.exported, act.diagnostics); err == nil {
+			r.cache.store(r.keys[pkg], e)
+		}
+	}
+	return act, nil
+}
+
+// importFact copies the fact stored under key into fact, which must be a
+// pointer to a value of the same type.
+func (r *runner) importFact(key factKey, fact analysis.Fact) bool {
+	stored, ok := r.facts[key]
+	if !ok {
+		return false
+	}
+	reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(stored).Elem())
+	return true
+}
@@ -0,0 +1,67 @@
+package errcheckstack
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Policy defines where errors must be wrapped.
+type Policy string
+
+const (
+	// PolicySource requires errors to be wrapped right where they enter the
+	// module, after every call to an external package or an interface. Every
+	// return of a naked error is reported.
+	PolicySource Policy = "wrap-at-source"
+	// PolicyBoundary requires errors to be wrapped before they cross a package
+	// boundary. Naked errors can flow freely within a package, but exported
+	// functions and methods, which other packages can call, must return
+	// wrapped errors.
+	PolicyBoundary Policy = "wrap-at-boundary"
+	// PolicyExported only requires the exported functions and methods of the
+	// packages under an internal directory, i.e. the layers of the module, to
+	// return wrapped errors.
+	PolicyExported Policy = "wrap-at-exported-api"
+)
+
+func (p Policy) validate() error {
+	switch p {
+	case "", PolicySource, PolicyBoundary, PolicyExported:
+		return nil
+	default:
+		return fmt.Errorf("unknown policy %q", p)
+	}
+}
+
+// policyRule returns whether the policy requires the returns of fdecl to be
+// wrapped, along with the explanation of the rule to append to diagnostics.
+// The default policy doesn't add any explanation. Functions marked with the
+// naked-ok directive never require it.
+func policyRule(cfg *Config, pass *analysis.Pass, fdecl *ast.FuncDecl) (string, bool) {
+	if hasDirective(fdecl, directiveNakedOK) {
+		return "", false
+	}
+	switch cfg.Policy {
+	case PolicyBoundary:
+		if !fdecl.Name.IsExported() {
+			return "", false
+		}
+		return fmt.Sprintf(" (%s: %s can be called from other packages and must return wrapped errors)", PolicyBoundary, fdecl.Name.Name), true
+	case PolicyExported:
+		if !fdecl.Name.IsExported() || !isInternalPkg(pass.Pkg.Path()) {
+			return "", false
+		}
+		return fmt.Sprintf(" (%s: %s is exported by the internal package %s and must return wrapped errors)", PolicyExported, fdecl.Name.Name, pass.Pkg.Path()), true
+	default:
+		return "", true
+	}
+}
+
+// isInternalPkg returns whether the package path is under an internal directory.
+func isInternalPkg(pkgPath string) bool {
+	return strings.HasPrefix(pkgPath, "internal/") || strings.Contains(pkgPath, "/internal/") ||
+		strings.HasSuffix(pkgPath, "/internal") || pkgPath == "internal"
+}
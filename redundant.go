@@ -0,0 +1,105 @@
+package errcheckstack
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// checkRedundantWrap reports calls to a wrapping function whose error argument
+// is already wrapped, as they only add a second, nearly identical, stack trace.
+//
+// The suggested fix removes the wrapping call, or when the call carries a
+// message and a message wrapper is configured, replaces it by the latter, or by
+// its formatting variant, such as WithMessagef, for variadic wrappers. No fix
+// is offered when the call carries a message that doesn't fit a message
+// wrapper, as removing the call would drop it.
+func checkRedundantWrap(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) {
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil || !isWrapper(cfg, pass, fn) {
+		return
+	}
+
+	var arg ast.Expr
+	for _, a := range call.Args {
+		if isError(pass.TypesInfo.TypeOf(a)) {
+			arg = a
+			break
+		}
+	}
+	if arg == nil || !exprWrapped(cfg, pass, arg) {
+		return
+	}
+
+	var fixes []analysis.SuggestedFix
+	if len(call.Args) == 1 {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, pass.Fset, astutil.Unparen(arg)); err != nil {
+			return
+		}
+		fixes = append(fixes, analysis.SuggestedFix{
+			Message: fmt.Sprintf("Remove redundant %s", fn.Name()),
+			TextEdits: []analysis.TextEdit{{
+				Pos:     call.Pos(),
+				End:     call.End(),
+				NewText: buf.Bytes(),
+			}},
+		})
+	} else if name, ok := messageWrapperName(cfg, fn.Pkg().Path()); ok {
+		if fn.Type().(*types.Signature).Variadic() {
+			name += "f"
+			if fn.Pkg().Scope().Lookup(name) == nil {
+				name = ""
+			}
+		} else if len(call.Args) != 2 {
+			name = ""
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && name != "" {
+			fixes = append(fixes, analysis.SuggestedFix{
+				Message: fmt.Sprintf("Replace %s with %s", fn.Name(), name),
+				TextEdits: []analysis.TextEdit{{
+					Pos:     sel.Sel.Pos(),
+					End:     sel.Sel.End(),
+					NewText: []byte(name),
+				}},
+			})
+		}
+	}
+
+	report(cfg, pass, RuleRedundantWrap, analysis.Diagnostic{
+		Pos:            call.Pos(),
+		End:            call.End(),
+		Message:        fmt.Sprintf("error passed to %s is already wrapped", fn.Name()),
+		SuggestedFixes: fixes,
+	})
+}
+
+// messageWrapperName returns the name of the configured message wrapper if it
+// belongs to the package pkgPath, so it can be called through the same import.
+func messageWrapperName(cfg *Config, pkgPath string) (string, bool) {
+	if !strings.HasPrefix(cfg.MessageWrapper, pkgPath+".") {
+		return "", false
+	}
+	name := strings.TrimPrefix(cfg.MessageWrapper, pkgPath+".")
+	if name == "" || strings.Contains(name, ".") {
+		return "", false
+	}
+	return name, true
+}
+
+// isMessageWrapper returns whether fn is the configured message wrapper, or
+// its formatting variant, which keep the wrapped status of the error they
+// annotate.
+func isMessageWrapper(cfg *Config, fn *types.Func) bool {
+	if cfg.MessageWrapper == "" {
+		return false
+	}
+	name := fn.FullName()
+	return name == cfg.MessageWrapper || name == cfg.MessageWrapper+"f"
+}
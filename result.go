@@ -0,0 +1,92 @@
+package errcheckstack
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Result is the result of the analyzer on a package, which analyzers requiring
+// it can build on instead of tracing errors again. Packages outside the module
+// have an empty result.
+type Result struct {
+	// Funcs summarizes the functions of the package returning errors.
+	Funcs map[*types.Func]*FuncSummary
+}
+
+// FuncSummary tells whether the errors returned by a function are wrapped, and
+// where they come from.
+type FuncSummary struct {
+	// Status is either StatusWrapped, StatusNaked or StatusUnknown, when none
+	// of the returned errors could be traced.
+	Status string
+	// Origins lists where the returned errors come from.
+	Origins []Origin
+	// Reason explains why the function is naked, it's empty otherwise.
+	Reason string
+}
+
+// Origin is where an error returned by a function comes from.
+type Origin struct {
+	// Callee is the function returning the error, nil for errors that don't
+	// come from a call, such as sentinels or errors received from a channel.
+	Callee *types.Func
+	// Wrapped tells whether the error is wrapped.
+	Wrapped bool
+	// Description describes the origin, such as "error returned by
+	// strconv.Atoi".
+	Description string
+	// Pos is where the error is obtained, such as the call site of Callee.
+	Pos token.Pos
+	// Stores are the positions where naked errors are stored in the field the
+	// error is loaded from, if any.
+	Stores []token.Pos
+}
+
+// newResult summarizes the functions returning errors found by scan. Their
+// status is read from their fact, so both always agree.
+func newResult(pass *analysis.Pass, calls []*wrappedCall) *Result {
+	res := &Result{Funcs: map[*types.Func]*FuncSummary{}}
+	for _, wc := range calls {
+		fn, ok := pass.TypesInfo.Defs[wc.fdecl.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+		summary := &FuncSummary{Status: StatusUnknown}
+		fact := wrapFact{}
+		if pass.ImportObjectFact(fn, &fact) {
+			summary.Status = StatusNaked
+			if fact.isWrapped {
+				summary.Status = StatusWrapped
+			}
+		}
+		for _, es := range wc.errSources {
+			summary.Origins = append(summary.Origins, Origin{Callee: es.fn, Wrapped: es.wrapped, Description: es.desc, Pos: es.pos, Stores: es.stores})
+			if summary.Status == StatusNaked && summary.Reason == "" && !es.wrapped {
+				summary.Reason = es.desc + " is not wrapped"
+			}
+		}
+		res.Funcs[fn] = summary
+	}
+	return res
+}
+
+// sourceDesc describes a source returned by valueSource.
+func sourceDesc(src ast.Expr) string {
+	if recv, ok := isReceive(src); ok {
+		return fmt.Sprintf("error received from channel %s", types.ExprString(recv.X))
+	}
+	return fmt.Sprintf("error loaded from field %s", types.ExprString(src))
+}
+
+// callDesc describes the error returned by a call to fn, which is nil when the
+// callee isn't known.
+func callDesc(fn *types.Func) string {
+	if fn == nil {
+		return "error returned by a call"
+	}
+	return "error returned by " + fn.FullName()
+}
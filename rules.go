@@ -0,0 +1,171 @@
+package errcheckstack
+
+import (
+	"fmt"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Rule identifies a kind of diagnostic. Rule IDs are stable, they are set as
+// the Category of the diagnostics so tools can tell them apart without relying
+// on messages, and each rule can be configured independently.
+type Rule string
+
+const (
+	// RuleInterface reports naked errors returned by a method of an interface.
+	RuleInterface Rule = "interface"
+	// RuleExternal reports naked errors returned by a function of an external
+	// package.
+	RuleExternal Rule = "external"
+	// RuleLocal reports naked errors returned by a function of the module.
+	RuleLocal Rule = "local"
+	// RuleErrorf reports fmt.Errorf calls wrapping a naked error with %w when
+	// ErrorfWrapping is enabled, fmt.Errorf only being as wrapped as the errors
+	// it wraps. Otherwise, fmt.Errorf is reported like any external function.
+	RuleErrorf Rule = "errorf"
+	// RuleErrgroup reports naked errors returned by errgroup.Group.Wait.
+	RuleErrgroup Rule = "errgroup"
+	// RuleChannel reports naked errors received from a channel.
+	RuleChannel Rule = "channel"
+	// RuleField reports naked errors loaded from a struct field.
+	RuleField Rule = "field"
+	// RuleSentinel reports sentinel errors returned without being wrapped.
+	RuleSentinel Rule = "sentinel"
+	// RuleSentinelWrapped reports sentinel errors that must not be wrapped.
+	RuleSentinelWrapped Rule = "sentinel-wrapped"
+	// RuleRedundantWrap reports errors wrapped twice.
+	RuleRedundantWrap Rule = "redundant-wrap"
+	// RuleWrongWrap reports wrappers applied to another error than the one
+	// checked by the enclosing condition.
+	RuleWrongWrap Rule = "wrong-wrap"
+	// RuleNilWrap reports wrappers applied to an error that is always nil.
+	RuleNilWrap Rule = "nil-wrap"
+	// RuleComparison reports == comparisons of possibly wrapped errors.
+	RuleComparison Rule = "comparison"
+	// RuleTypeAssertion reports type assertions and type switches on possibly
+	// wrapped errors.
+	RuleTypeAssertion Rule = "type-assertion"
+	// RuleSink reports naked errors passed to a sink.
+	RuleSink Rule = "sink"
+)
+
+// Rules lists all the rules along with their description.
+var Rules = []struct {
+	ID          Rule
+	Description string
+}{
+	{RuleInterface, "Naked error returned by an interface method"},
+	{RuleExternal, "Naked error returned by an external package"},
+	{RuleLocal, "Naked error returned by a function of the module"},
+	{RuleErrorf, "Naked error wrapped with fmt.Errorf %w, with errorfWrapping enabled"},
+	{RuleErrgroup, "Naked error returned by a function passed to errgroup.Group.Go"},
+	{RuleChannel, "Naked error received from a channel"},
+	{RuleField, "Naked error loaded from a struct field"},
+	{RuleSentinel, "Sentinel error returned without being wrapped"},
+	{RuleSentinelWrapped, "Sentinel error that must not be wrapped is wrapped"},
+	{RuleRedundantWrap, "Error wrapped twice"},
+	{RuleWrongWrap, "Wrapper applied to the wrong error"},
+	{RuleNilWrap, "Wrapper applied to an error that is always nil"},
+	{RuleComparison, "Comparison of a possibly wrapped error"},
+	{RuleTypeAssertion, "Type assertion on a possibly wrapped error"},
+	{RuleSink, "Naked error passed to a sink"},
+}
+
+// Severity is the severity of the diagnostics of a rule.
+type Severity string
+
+const (
+	// SeverityError is the default severity. Drivers exit with an error when
+	// such diagnostics are found.
+	SeverityError Severity = "error"
+	// SeverityWarning diagnostics are reported but don't fail drivers.
+	SeverityWarning Severity = "warning"
+	// SeverityInfo diagnostics are reported but don't fail drivers.
+	SeverityInfo Severity = "info"
+)
+
+// RuleConfig overrides the default settings of a rule.
+type RuleConfig struct {
+	// Enabled enables or disables the rule. Rules are enabled by default,
+	// except the ones turned on by an option, such as checkComparisons, which
+	// this also turns on. Disabling a rule only silences its diagnostics, the
+	// wrapped status of functions is unchanged.
+	Enabled *bool `yaml:"enabled"`
+	// Severity defaults to error. It is only honored by the errcheckstack
+	// command and Check. Other drivers, such as the singlechecker, go vet or
+	// golangci-lint, report all diagnostics alike, so DecodeSettings rejects
+	// it.
+	Severity Severity `yaml:"severity"`
+}
+
+// validateRules checks that the configured rules and severities exist.
+func validateRules(rules map[Rule]RuleConfig) error {
+	for id, rc := range rules {
+		if !isRule(id) {
+			return fmt.Errorf("unknown rule %q", id)
+		}
+		switch rc.Severity {
+		case "", SeverityError, SeverityWarning, SeverityInfo:
+		default:
+			return fmt.Errorf("unknown severity %q for rule %q", rc.Severity, id)
+		}
+	}
+	return nil
+}
+
+func isRule(id Rule) bool {
+	for _, r := range Rules {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleEnabled returns whether the diagnostics of the rule are reported.
+func (c *Config) RuleEnabled(rule Rule) bool {
+	if rc, ok := c.Rules[rule]; ok && rc.Enabled != nil {
+		return *rc.Enabled
+	}
+	switch rule {
+	case RuleComparison, RuleTypeAssertion:
+		return c.CheckComparisons
+	case RuleRedundantWrap:
+		return c.RedundantWrap
+	}
+	return true
+}
+
+// HasSeverities returns whether the severity of any rule is set.
+func (c *Config) HasSeverities() bool {
+	for _, rc := range c.Rules {
+		if rc.Severity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleSeverity returns the severity of the diagnostics of the rule, as
+// given by their category.
+func (c *Config) RuleSeverity(rule Rule) Severity {
+	if rc, ok := c.Rules[rule]; ok && rc.Severity != "" {
+		return rc.Severity
+	}
+	return SeverityError
+}
+
+// report reports d as a diagnostic of the given rule, unless it's disabled.
+func report(cfg *Config, pass *analysis.Pass, rule Rule, d analysis.Diagnostic) {
+	if !cfg.RuleEnabled(rule) {
+		return
+	}
+	d.Category = string(rule)
+	pass.Report(d)
+}
+
+// reportf is like report, for diagnostics made of a message only.
+func reportf(cfg *Config, pass *analysis.Pass, rule Rule, pos token.Pos, format string, args ...interface{}) {
+	report(cfg, pass, rule, analysis.Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,141 @@
+package errcheckstack
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// SentinelPolicy defines how a sentinel error may be returned.
+type SentinelPolicy string
+
+const (
+	// SentinelMustWrap requires the sentinel to be wrapped like any other error.
+	SentinelMustWrap SentinelPolicy = "must-wrap"
+	// SentinelMayReturnBare allows returning the sentinel without wrapping it.
+	SentinelMayReturnBare SentinelPolicy = "may-return-bare"
+	// SentinelMustNotWrap forbids wrapping the sentinel, because callers are
+	// comparing it with == rather than errors.Is.
+	SentinelMustNotWrap SentinelPolicy = "must-not-wrap"
+)
+
+// Sentinel is a sentinel error and the policy that applies to it.
+type Sentinel struct {
+	// Name is the full name of the sentinel error, such as io.EOF or
+	// database/sql.ErrNoRows.
+	Name string `yaml:"name"`
+	// Policy overrides the default policy for this sentinel.
+	Policy SentinelPolicy `yaml:"policy"`
+}
+
+// SentinelConfig lists the sentinel errors that the analyzer recognizes.
+//
+// Sentinel errors that aren't listed, or auto detected, are handled like any
+// other error.
+type SentinelConfig struct {
+	// Allowed lists the sentinel errors, with their optional policy.
+	Allowed []Sentinel `yaml:"allowed"`
+	// AutoDetect treats any package level variable of type error whose name
+	// starts with Err as a sentinel.
+	AutoDetect bool `yaml:"autoDetect"`
+	// DefaultPolicy applies to sentinels without a policy of their own. It
+	// defaults to may-return-bare.
+	DefaultPolicy SentinelPolicy `yaml:"defaultPolicy"`
+}
+
+func (sc *SentinelConfig) validate() error {
+	policies := []SentinelPolicy{sc.DefaultPolicy}
+	for _, s := range sc.Allowed {
+		policies = append(policies, s.Policy)
+	}
+	for _, p := range policies {
+		switch p {
+		case "", SentinelMustWrap, SentinelMayReturnBare, SentinelMustNotWrap:
+		default:
+			return fmt.Errorf("unknown sentinel policy %q", p)
+		}
+	}
+	return nil
+}
+
+// defaultPolicy returns the policy of the sentinels without one of their own.
+func (sc *SentinelConfig) defaultPolicy() SentinelPolicy {
+	if sc.DefaultPolicy == "" {
+		return SentinelMayReturnBare
+	}
+	return sc.DefaultPolicy
+}
+
+// policy returns the policy to apply to a sentinel, if v is one.
+func (sc *SentinelConfig) policy(v *types.Var) (SentinelPolicy, bool) {
+	defaultPolicy := sc.defaultPolicy()
+
+	name := sentinelName(v)
+	for _, s := range sc.Allowed {
+		if s.Name != name {
+			continue
+		}
+		if s.Policy == "" {
+			return defaultPolicy, true
+		}
+		return s.Policy, true
+	}
+
+	if sc.AutoDetect && strings.HasPrefix(v.Name(), "Err") && isError(v.Type()) {
+		return defaultPolicy, true
+	}
+	return "", false
+}
+
+// sentinelOf returns the sentinel error expr refers to, along with its policy.
+func sentinelOf(cfg *Config, pass *analysis.Pass, expr ast.Expr) (*types.Var, SentinelPolicy, bool) {
+	var ident *ast.Ident
+	switch e := astutil.Unparen(expr).(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return nil, "", false
+	}
+
+	v, ok := pass.TypesInfo.ObjectOf(ident).(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		// Only package level variables can be sentinels.
+		return nil, "", false
+	}
+
+	policy, ok := cfg.Sentinels.policy(v)
+	if !ok {
+		if !isStubSentinel(cfg, v) {
+			return nil, "", false
+		}
+		policy = cfg.Sentinels.defaultPolicy()
+	}
+	return v, policy, true
+}
+
+// sentinelName returns the full name of a sentinel, such as io.EOF.
+func sentinelName(v *types.Var) string {
+	return v.Pkg().Path() + "." + v.Name()
+}
+
+// checkWrappedSentinel reports calls to a wrapping function applied to a
+// sentinel error that must not be wrapped.
+func checkWrappedSentinel(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) {
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil || !isWrapper(cfg, pass, fn) {
+		return
+	}
+
+	for _, arg := range call.Args {
+		v, policy, ok := sentinelOf(cfg, pass, arg)
+		if ok && policy == SentinelMustNotWrap {
+			reportf(cfg, pass, RuleSentinelWrapped, arg.Pos(), "sentinel error %s must not be wrapped", sentinelName(v))
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package errcheckstack
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeSettings converts the settings of a linter runner, such as the custom
+// linters settings of .golangci.yml decoded as nested maps, into a Config. It
+// goes through YAML, so the keys are the ones of the config.yml file of the
+// errcheckstack command.
+//
+// The entrypoints mode is rejected, as the runner analyzes packages one at a
+// time, and so are rule severities, which the runner doesn't know about.
+func DecodeSettings(conf interface{}) (Config, error) {
+	var cfg Config
+	if conf == nil {
+		return cfg, fmt.Errorf("errcheckstack: missing settings, moduleName is required")
+	}
+	b, err := yaml.Marshal(conf)
+	if err != nil {
+		return cfg, fmt.Errorf("errcheckstack: invalid settings: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("errcheckstack: invalid settings: %w", err)
+	}
+	if cfg.ModuleName == "" {
+		return cfg, fmt.Errorf("errcheckstack: moduleName is required")
+	}
+	if cfg.Entrypoints.Enabled {
+		return cfg, fmt.Errorf("errcheckstack: entrypoints require the whole program, use the errcheckstack command")
+	}
+	if cfg.HasSeverities() {
+		return cfg, fmt.Errorf("errcheckstack: rule severities are only supported by the errcheckstack command, use the severity settings of the runner")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,75 @@
+package errcheckstack
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Sink is a function consuming errors, such as a logger, an error reporter or
+// an exit path. Errors reaching a sink never make it to main, so they must be
+// wrapped by then.
+type Sink struct {
+	// Signature is the full name of the function, such as log.Printf or, for
+	// methods, (*testing.common).Fatal.
+	Signature string `yaml:"signature"`
+	// ErrArg is the index of the error among the arguments of the call.
+	ErrArg int `yaml:"errArg"`
+}
+
+// checkSink reports naked errors passed to one of the configured sinks. The
+// error is traced back to the calls producing it, just like returned errors.
+func checkSink(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) {
+	for _, sink := range sinksOf(cfg, pass, call) {
+		arg := call.Args[sink.ErrArg]
+		sources, _ := errorSources(pass, arg)
+		for _, src := range sources {
+			if sourceWrapped(cfg, pass, src) {
+				continue
+			}
+			origin, _, ok := sourceOrigin(cfg, pass, src)
+			if !ok {
+				continue
+			}
+			reportf(cfg, pass, RuleSink, arg.Pos(), "error %s is passed to %s without being wrapped", origin, sink.Signature)
+			break
+		}
+	}
+}
+
+// isSinkArg returns whether arg is the error argument of a sink called by call.
+func isSinkArg(cfg *Config, pass *analysis.Pass, call *ast.CallExpr, arg ast.Expr) bool {
+	for _, sink := range sinksOf(cfg, pass, call) {
+		if call.Args[sink.ErrArg] == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// sinksOf returns the configured sinks call is a call to, whose error argument
+// is indeed an error.
+func sinksOf(cfg *Config, pass *analysis.Pass, call *ast.CallExpr) []Sink {
+	if len(cfg.Sinks) == 0 {
+		return nil
+	}
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil {
+		return nil
+	}
+
+	var sinks []Sink
+	for _, sink := range cfg.Sinks {
+		if sink.Signature != fn.FullName() {
+			continue
+		}
+		if sink.ErrArg < 0 || sink.ErrArg >= len(call.Args) {
+			continue
+		}
+		if !isError(pass.TypesInfo.TypeOf(call.Args[sink.ErrArg])) {
+			continue
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
@@ -0,0 +1,133 @@
+// Package stacktest provides test helpers checking at runtime what the
+// analyzer checks statically: that errors carry a stack trace recorded within
+// the module.
+//
+// It covers what static analysis can't see, such as errors built through
+// reflection, plugins or crossing RPC boundaries. Both the errors of
+// github.com/cockroachdb/errors and github.com/pkg/errors are supported.
+package stacktest
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// stackTracer is implemented by the errors carrying a stack trace. The
+// cockroachdb errors use the same StackTrace type as pkg/errors.
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// Checker checks errors against the module of the analyzer configuration, so
+// the static and runtime checks agree on what the module is.
+//
+// It only takes the module path, rather than the configuration itself, for
+// tests not to depend on the analyzer and its dependencies.
+type Checker struct {
+	module string
+}
+
+// New returns a Checker for the module path, the moduleName of the analyzer
+// configuration.
+func New(module string) *Checker {
+	return &Checker{module: module}
+}
+
+// RequireStack fails the test unless err carries a stack trace whose innermost
+// frame is inside the module. Without a module path, any stack trace is
+// accepted.
+func (c *Checker) RequireStack(t testing.TB, err error) {
+	t.Helper()
+	if c.module == "" {
+		RequireStack(t, err)
+		return
+	}
+	RequireFrameIn(t, err, c.module+"/...")
+}
+
+// RequireStack fails the test unless err carries a stack trace.
+func RequireStack(t testing.TB, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("expected an error with a stack trace, got nil")
+		return
+	}
+	if _, ok := innermostFrame(err); !ok {
+		t.Fatalf("error %q doesn't carry a stack trace", err)
+	}
+}
+
+// RequireFrameIn fails the test unless the innermost frame of the stack
+// trace carried by err belongs to a package matching pattern. Patterns are
+// package paths, where a trailing /... matches the package and all its
+// subpackages, such as mycorp/... .
+func RequireFrameIn(t testing.TB, err error, pattern string) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("expected an error with a stack trace, got nil")
+		return
+	}
+	fn, ok := innermostFrame(err)
+	if !ok {
+		t.Fatalf("error %q doesn't carry a stack trace", err)
+		return
+	}
+	if !matchPackage(pattern, funcPackage(fn)) {
+		t.Fatalf("error %q has its innermost frame in %s, outside of %s", err, fn, pattern)
+	}
+}
+
+// innermostFrame returns the name of the function where the innermost stack
+// trace of the chain was recorded, which is the closest to where the error
+// originated.
+func innermostFrame(err error) (string, bool) {
+	var st pkgerrors.StackTrace
+	for ; err != nil; err = unwrap(err) {
+		if tracer, ok := err.(stackTracer); ok && len(tracer.StackTrace()) > 0 {
+			st = tracer.StackTrace()
+		}
+	}
+	if len(st) == 0 {
+		return "", false
+	}
+	// Frames hold the return address of the calls, see pkg/errors.Frame.
+	fn := runtime.FuncForPC(uintptr(st[0]) - 1)
+	if fn == nil {
+		return "", false
+	}
+	return fn.Name(), true
+}
+
+// unwrap returns the next error of the chain, supporting both the standard
+// Unwrap method and the Cause method of pkg/errors.
+func unwrap(err error) error {
+	if next := errors.Unwrap(err); next != nil {
+		return next
+	}
+	if causer, ok := err.(interface{ Cause() error }); ok {
+		return causer.Cause()
+	}
+	return nil
+}
+
+// funcPackage returns the package path of a function name as reported by the
+// runtime, such as github.com/a/b.(*T).Method.
+func funcPackage(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// matchPackage returns whether the package path matches the pattern.
+func matchPackage(pattern string, pkgPath string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		return pkgPath == prefix || strings.HasPrefix(pkgPath, prefix+"/")
+	}
+	return pkgPath == pattern
+}
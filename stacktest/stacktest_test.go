@@ -0,0 +1,85 @@
+package stacktest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	crdberrors "github.com/cockroachdb/errors"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records whether a helper failed the test instead of failing it.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatal(args ...interface{}) {
+	r.failed = true
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+func TestRequireStack(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		failed bool
+	}{
+		"nil":              {err: nil, failed: true},
+		"naked":            {err: errors.New("naked"), failed: true},
+		"cockroachdb":      {err: crdberrors.New("wrapped")},
+		"pkg/errors":       {err: pkgerrors.New("wrapped")},
+		"with stack":       {err: crdberrors.WithStack(errors.New("naked"))},
+		"errorf %w":        {err: fmt.Errorf("outer: %w", pkgerrors.WithStack(errors.New("naked")))},
+		"errorf naked %w":  {err: fmt.Errorf("outer: %w", errors.New("naked")), failed: true},
+		"pkg/errors cause": {err: pkgerrors.WithMessage(pkgerrors.New("wrapped"), "outer")},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &recorder{TB: t}
+			RequireStack(r, tt.err)
+			assert.Equal(t, tt.failed, r.failed)
+		})
+	}
+}
+
+func TestRequireFrameIn(t *testing.T) {
+	err := crdberrors.New("wrapped")
+	tests := map[string]bool{
+		"github.com/jhchabran/errcheckstack/...":           false,
+		"github.com/jhchabran/errcheckstack/stacktest":     false,
+		"github.com/jhchabran/errcheckstack/stacktest/...": false,
+		"github.com/jhchabran/errcheckstack":               true,
+		"github.com/cockroachdb/errors/...":                true,
+		"mycorp/...":                                       true,
+	}
+	for pattern, failed := range tests {
+		t.Run(pattern, func(t *testing.T) {
+			r := &recorder{TB: t}
+			RequireFrameIn(r, err, pattern)
+			assert.Equal(t, failed, r.failed)
+		})
+	}
+}
+
+func TestChecker(t *testing.T) {
+	err := pkgerrors.New("wrapped")
+
+	r := &recorder{TB: t}
+	New("github.com/jhchabran/errcheckstack").RequireStack(r, err)
+	assert.False(t, r.failed)
+
+	r = &recorder{TB: t}
+	New("mycorp").RequireStack(r, err)
+	assert.True(t, r.failed)
+
+	r = &recorder{TB: t}
+	New("").RequireStack(r, errors.New("naked"))
+	assert.True(t, r.failed)
+}
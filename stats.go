@@ -0,0 +1,118 @@
+package errcheckstack
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jhchabran/errcheckstack/internal/driver"
+)
+
+// Counts counts the functions returning errors by wrapped status.
+type Counts struct {
+	Total   int `json:"total"`
+	Wrapped int `json:"wrapped"`
+	Naked   int `json:"naked"`
+	// Unknown counts the functions the analyzer couldn't tell anything about,
+	// such as the ones only returning function parameters.
+	Unknown int `json:"unknown"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Total += o.Total
+	c.Wrapped += o.Wrapped
+	c.Naked += o.Naked
+	c.Unknown += o.Unknown
+}
+
+// PackageStats holds the counts of a single package.
+type PackageStats struct {
+	Path string `json:"path"`
+	Counts
+}
+
+// CalleeStats tells how many functions of the module return naked errors
+// coming from an external function.
+type CalleeStats struct {
+	Callee string `json:"callee"`
+	// NakedFunctions is the number of functions returning naked errors from
+	// the callee, however many times each of them calls it.
+	NakedFunctions int `json:"nakedFunctions"`
+}
+
+// Stats is a coverage report of the wrapped status of the functions of the
+// module.
+type Stats struct {
+	Packages []PackageStats `json:"packages"`
+	Module   Counts         `json:"module"`
+	// NakedCallees lists the external functions causing naked errors, the
+	// ones making the most functions of the module naked first.
+	NakedCallees []CalleeStats `json:"nakedCallees"`
+}
+
+// ComputeStats analyzes the packages matching the patterns in dir and counts
+// their wrapped, naked and unknown functions, based on the facts exported by
+// the analyzer.
+func ComputeStats(dir string, cfg Config, patterns ...string) (*Stats, error) {
+	pkgs, err := driver.Load(context.Background(), dir, nil, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := driver.Run(context.Background(), newProgramAnalyzer(cfg), pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	callees := map[string]int{}
+	for _, p := range res.Packages {
+		r, ok := p.Result.(*Result)
+		if !ok {
+			continue
+		}
+
+		ps := PackageStats{Path: p.Pkg.PkgPath}
+		for _, summary := range r.Funcs {
+			ps.Total++
+			switch summary.Status {
+			case StatusWrapped:
+				ps.Wrapped++
+			case StatusNaked:
+				ps.Naked++
+			default:
+				ps.Unknown++
+			}
+
+			seen := map[string]bool{}
+			for _, o := range summary.Origins {
+				if o.Wrapped || o.Callee == nil || o.Callee.Pkg() == nil || strings.HasPrefix(o.Callee.Pkg().Path(), cfg.ModuleName) {
+					continue
+				}
+				if name := o.Callee.FullName(); !seen[name] {
+					seen[name] = true
+					callees[name]++
+				}
+			}
+		}
+		if ps.Total == 0 {
+			continue
+		}
+		stats.Packages = append(stats.Packages, ps)
+		stats.Module.add(ps.Counts)
+	}
+
+	sort.Slice(stats.Packages, func(i, j int) bool {
+		return stats.Packages[i].Path < stats.Packages[j].Path
+	})
+	for callee, n := range callees {
+		stats.NakedCallees = append(stats.NakedCallees, CalleeStats{Callee: callee, NakedFunctions: n})
+	}
+	sort.Slice(stats.NakedCallees, func(i, j int) bool {
+		a, b := stats.NakedCallees[i], stats.NakedCallees[j]
+		if a.NakedFunctions != b.NakedFunctions {
+			return a.NakedFunctions > b.NakedFunctions
+		}
+		return a.Callee < b.Callee
+	})
+	return stats, nil
+}
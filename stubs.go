@@ -0,0 +1,178 @@
+package errcheckstack
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// stdlibStubs describes the error behaviour of common standard library
+// functions and variables.
+//
+//go:embed stubs/stdlib.stubs
+var stdlibStubs []byte
+
+// stubKind is the error behaviour of an external function or variable.
+type stubKind string
+
+const (
+	// stubWrapped functions return wrapped errors.
+	stubWrapped stubKind = "wrapped"
+	// stubNaked functions return naked errors, which is the default for
+	// external functions.
+	stubNaked stubKind = "naked"
+	// stubSentinel variables are sentinel errors.
+	stubSentinel stubKind = "sentinel"
+	// stubPassthrough functions return one of their arguments, as wrapped as
+	// it was.
+	stubPassthrough stubKind = "passthrough"
+)
+
+type stub struct {
+	kind stubKind
+	// arg is the index of the argument returned by passthrough functions.
+	arg int
+}
+
+// stubSet maps the full names of functions and variables to their stub.
+type stubSet map[string]stub
+
+// loadStubs loads the stub files of the configuration, after the standard
+// library ones when enabled. Later stubs override earlier ones.
+func loadStubs(cfg *Config) (stubSet, error) {
+	stubs := stubSet{}
+	if cfg.StdlibStubs {
+		if err := stubs.parse(bytes.NewReader(stdlibStubs), "stdlib.stubs"); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range cfg.Stubs {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stubs: %w", err)
+		}
+		err = stubs.parse(f, path)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stubs, nil
+}
+
+// parse parses a stub file, made of lines such as io.ReadAll: naked. Empty
+// lines and lines starting with # are ignored.
+func (s stubSet) parse(r io.Reader, filename string) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.LastIndex(text, ":")
+		if i < 0 {
+			return fmt.Errorf("%s:%d: expected <name>: <behaviour>", filename, line)
+		}
+		name, behaviour := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		st, err := parseStub(behaviour)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+		s[name] = st
+	}
+	return sc.Err()
+}
+
+func parseStub(behaviour string) (stub, error) {
+	switch stubKind(behaviour) {
+	case stubWrapped, stubNaked, stubSentinel:
+		return stub{kind: stubKind(behaviour)}, nil
+	}
+	if strings.HasPrefix(behaviour, "passthrough(arg") && strings.HasSuffix(behaviour, ")") {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(behaviour, "passthrough(arg"), ")"))
+		if err == nil && n >= 0 {
+			return stub{kind: stubPassthrough, arg: n}, nil
+		}
+	}
+	return stub{}, fmt.Errorf("unknown behaviour %q, expected wrapped, naked, sentinel or passthrough(argN)", behaviour)
+}
+
+// stubWrappedCall returns whether the function called has a stub, and if so
+// whether the error returned by the call is wrapped.
+func stubWrappedCall(cfg *Config, pass *analysis.Pass, fn *types.Func, call *ast.CallExpr) (wrapped bool, ok bool) {
+	st, ok := cfg.stubs[fn.FullName()]
+	if !ok {
+		return false, false
+	}
+	switch st.kind {
+	case stubWrapped:
+		return true, true
+	case stubPassthrough:
+		if st.arg >= len(call.Args) {
+			return false, true
+		}
+		return returnedWrapped(cfg, pass, call.Args[st.arg]), true
+	default:
+		return false, true
+	}
+}
+
+// exportStubFacts exports the facts of the functions of the package described
+// by a wrapped or naked stub, so that the function values and method values
+// referring to them, such as the ones passed to errgroup.Group.Go, behave as
+// described too. Passthrough stubs depend on the call, they are left to
+// stubWrappedCall.
+func exportStubFacts(cfg *Config, pass *analysis.Pass) {
+	prefix := pass.Pkg.Path() + "."
+	described := false
+	for name := range cfg.stubs {
+		if strings.Contains(name, prefix) {
+			described = true
+			break
+		}
+	}
+	if !described {
+		return
+	}
+
+	export := func(fn *types.Func) {
+		st, ok := cfg.stubs[fn.FullName()]
+		if !ok {
+			return
+		}
+		switch st.kind {
+		case stubWrapped:
+			pass.ExportObjectFact(fn, &wrapFact{isWrapped: true})
+		case stubNaked:
+			pass.ExportObjectFact(fn, &wrapFact{isWrapped: false})
+		}
+	}
+	scope := pass.Pkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Func:
+			export(obj)
+		case *types.TypeName:
+			if named, ok := obj.Type().(*types.Named); ok {
+				for i := 0; i < named.NumMethods(); i++ {
+					export(named.Method(i))
+				}
+			}
+		}
+	}
+}
+
+// isStubSentinel returns whether v is described as a sentinel by a stub.
+func isStubSentinel(cfg *Config, v *types.Var) bool {
+	st, ok := cfg.stubs[sentinelName(v)]
+	return ok && st.kind == stubSentinel
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"comparison/a"
+	"io"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+var ErrFoo = errors.New("foo")
+
+type MyErr struct{}
+
+func (e *MyErr) Error() string { return "my error" }
+
+func main() {
+	wrapped()
+	naked()
+}
+
+func wrapped() error { // want wrapped:"wrapped"
+	err := a.A()
+	if err == ErrFoo { // want `comparison of error err with == may fail on wrapped errors, use errors.Is`
+		return nil
+	}
+	if ErrFoo != (err) { // want `comparison of error err with != may fail on wrapped errors, use errors.Is`
+		return nil
+	}
+	if _, ok := err.(*MyErr); ok { // want `type assertion on error err may fail on wrapped errors, use errors.As`
+		return nil
+	}
+	switch err.(type) { // want `type switch on error err may fail on wrapped errors, use errors.As`
+	case *MyErr:
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+func naked() error { // want naked:"wrapped"
+	_, err := strconv.Atoi("naked")
+	if err == strconv.ErrSyntax {
+		return nil
+	}
+	if e, ok := err.(*strconv.NumError); ok {
+		return errors.WithStack(e)
+	}
+	return errors.WithStack(err)
+}
+
+type reader struct {
+	fn func() error
+}
+
+func (r *reader) done() bool {
+	return r.fn() == io.EOF
+}
@@ -0,0 +1,15 @@
+package a
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+)
+
+func Wrapped() error { // want Wrapped:"wrapped"
+	return errors.WithStack(fmt.Errorf("wrapped"))
+}
+
+func Naked() error { // want Naked:"naked"
+	return fmt.Errorf("naked") // want `error returned from external package is not wrapped`
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"concurrency/a"
+	"context"
+	"log"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func main() {
+	group()
+	nakedGroup()
+	channel()
+	nakedChannel()
+	loggedGroup()
+	returnedGroup()
+}
+
+func group() error { // want group:"wrapped"
+	var g errgroup.Group
+	g.Go(func() error {
+		return a.Wrapped()
+	})
+	g.Go(a.Wrapped)
+	return g.Wait()
+}
+
+func nakedGroup() error { // want nakedGroup:"naked"
+	g, _ := errgroup.WithContext(context.Background())
+	g.Go(func() error {
+		return a.Naked()
+	})
+	return g.Wait() // want `error returned by a function passed to errgroup.Group.Go is not wrapped`
+}
+
+func channel() error { // want channel:"wrapped"
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- a.Wrapped()
+	}()
+	errCh <- nil
+	return <-errCh
+}
+
+func nakedChannel() error { // want nakedChannel:"naked"
+	errCh := make(chan error, 1)
+	_, err := strconv.Atoi("naked")
+	errCh <- err
+	recvErr := <-errCh
+	return recvErr // want `error received from channel errCh is not wrapped`
+}
+
+func loggedGroup() error {
+	var g errgroup.Group
+	g.Go(func() error {
+		_, err := strconv.Atoi("naked")
+		return err // want `error returned from external package is not wrapped`
+	})
+	if err := g.Wait(); err != nil {
+		log.Print(err)
+	}
+	return nil
+}
+
+func returnedGroup() error { // want returnedGroup:"naked"
+	var g errgroup.Group
+	g.Go(func() error {
+		return a.Naked()
+	})
+	if err := g.Wait(); err != nil {
+		return err // want `error returned by a function passed to errgroup.Group.Go is not wrapped`
+	}
+	return nil
+}
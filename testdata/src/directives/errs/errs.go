@@ -0,0 +1,28 @@
+package errs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type codeErr struct {
+	err   error // want err:"naked"
+	code  int
+	stack []uintptr
+}
+
+func (e *codeErr) Error() string { return fmt.Sprintf("%d: %v", e.code, e.err) }
+
+// Unwrap returns the annotated error, which is naked.
+//
+//errcheckstack:naked-ok
+func (e *codeErr) Unwrap() error { return e.err } // want Unwrap:"naked"
+
+// Internal annotates err with a code and the stack trace of the caller.
+//
+//errcheckstack:wrapper
+func Internal(err error, code int) error { // want Internal:"wrapper"
+	stack := make([]uintptr, 32)
+	n := runtime.Callers(2, stack)
+	return &codeErr{err: err, code: code, stack: stack[:n]}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"directives/errs"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+func main() {
+	_ = imported()
+	_ = local()
+	_ = intentional()
+	_ = naked()
+}
+
+func imported() error { // want imported:"wrapped"
+	_, err := strconv.Atoi("wrapped")
+	return errs.Internal(err, 500)
+}
+
+func local() error { // want local:"wrapped"
+	_, err := strconv.Atoi("wrapped")
+	return annotate(err)
+}
+
+//errcheckstack:wrapper
+func annotate(err error) error { // want annotate:"wrapper" annotate:"wrapped"
+	return errors.WithStack(err)
+}
+
+// intentional returns the errors of strconv as is, for callers to compare
+// them.
+//
+//errcheckstack:naked-ok
+func intentional() error { // want intentional:"naked"
+	_, err := strconv.Atoi("naked")
+	return err
+}
+
+func naked() error { // want naked:"naked"
+	_, err := strconv.Atoi("naked")
+	return err // want `error returned from external package is not wrapped`
+}
@@ -0,0 +1,19 @@
+package a
+
+import "fmt"
+
+func Reached() error { // want Reached:"naked"
+	return fmt.Errorf("reached") // want `error returned from external package is not wrapped`
+}
+
+func Propagated() error { // want Propagated:"naked"
+	return fmt.Errorf("propagated") // want `error returned from external package is not wrapped`
+}
+
+func Unreached() error { // want Unreached:"naked"
+	return fmt.Errorf("unreached") // want `error returned from external package is not wrapped`
+}
+
+func Handler() error { // want Handler:"naked"
+	return fmt.Errorf("handler") // want `error returned from external package is not wrapped`
+}
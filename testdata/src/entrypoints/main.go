@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+
+	"entrypoints/a"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run discards the error of a.Reached, which never reaches main.
+func run() error { // want run:"naked"
+	a.Reached()
+	return a.Propagated() // want `error returned from external package is not wrapped`
+}
@@ -0,0 +1,29 @@
+package b
+
+import (
+	"errorf_wrap/a"
+	"fmt"
+	"strconv"
+)
+
+func B() error { // want B:"wrapped"
+	err := a.A()
+	if err != nil {
+		return fmt.Errorf("b: %w", err)
+	}
+	return nil
+}
+
+func Indexed() error { // want Indexed:"wrapped"
+	return fmt.Errorf("%*d %[4]w %[3]s", 10, 42, "indexed", a.A())
+}
+
+func Naked() error { // want Naked:"naked"
+	_, err := strconv.Atoi("naked")
+	return fmt.Errorf("naked: %w", err) // want `error wrapped with fmt.Errorf %w is not wrapped`
+}
+
+func Canary() error { // want Canary:"naked"
+	err := a.A()
+	return fmt.Errorf("canary: %v", err) // want `error returned from external package is not wrapped`
+}
@@ -0,0 +1,10 @@
+package main
+
+import "errorf_wrap/b"
+
+func main() {
+	b.B()
+	b.Indexed()
+	b.Naked()
+	b.Canary()
+}
@@ -0,0 +1,11 @@
+package fill // want package:"naked fields fields/store Shared.UF0"
+
+import (
+	"fields/store"
+	"strconv"
+)
+
+// Fill stores a naked error in a field declared by another package.
+func Fill(s *store.Shared) {
+	_, s.Err = strconv.Atoi("naked")
+}
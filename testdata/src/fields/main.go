@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fields/fill"
+	"fields/store"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+func main() {
+	s := &server{}
+	s.run()
+	_ = s.last()
+	_ = s.ok()
+	_ = use()
+	_ = loaded()
+}
+
+type server struct {
+	lastErr error // want lastErr:"naked"
+	okErr   error // want okErr:"wrapped"
+}
+
+type result struct {
+	v   int
+	err error // want err:"wrapped"
+}
+
+func (s *server) run() {
+	_, err := strconv.Atoi("naked")
+	s.lastErr = err
+	s.lastErr = errors.WithStack(err)
+	s.okErr = errors.WithStack(err)
+	s.okErr = nil
+}
+
+func (s *server) last() error { // want last:"naked"
+	return s.lastErr // want `error loaded from field s.lastErr \(naked stores: main.go:\d+:\d+\) is not wrapped`
+}
+
+func (s *server) ok() error { // want ok:"wrapped"
+	return s.okErr
+}
+
+func compute() result {
+	_, err := strconv.Atoi("naked")
+	return result{v: 1, err: errors.WithStack(err)}
+}
+
+func use() error { // want use:"wrapped"
+	r := compute()
+	err := r.err
+	return err
+}
+
+func loaded() error { // want loaded:"naked"
+	s := store.Store{}
+	s.Load("naked")
+	return s.Err // want `error loaded from field s.Err, stored naked by package fields/store, is not wrapped`
+}
+
+func filled() error { // want filled:"naked"
+	s := &store.Shared{}
+	fill.Fill(s)
+	return s.Err // want `error loaded from field s.Err, stored naked by package fields/fill, is not wrapped`
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"strconv"
+)
+
+type Store struct {
+	Err error // want Err:"naked"
+}
+
+func (s *Store) Load(v string) {
+	_, s.Err = strconv.Atoi(v)
+}
+
+// Shared is filled by other packages.
+type Shared struct {
+	Err error
+}
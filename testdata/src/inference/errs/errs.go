@@ -0,0 +1,47 @@
+package errs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type codeErr struct {
+	err   error // want err:"naked"
+	code  int
+	stack []uintptr
+}
+
+func (e *codeErr) Error() string { return fmt.Sprintf("%d: %v", e.code, e.err) }
+
+// Internal annotates err with a code and the stack trace of the caller.
+func Internal(err error, code int) error { // want Internal:"inferred wrapper"
+	if err == nil {
+		return nil
+	}
+	stack := make([]uintptr, 32)
+	n := runtime.Callers(2, stack)
+	return &codeErr{err: err, code: code, stack: stack[:n]}
+}
+
+// Code annotates err with a code, without any stack trace.
+func Code(err error, code int) error {
+	return &codeErr{err: err, code: code}
+}
+
+// Maybe only captures a stack trace for the errors having a code, returning
+// the others as is, so it's not a wrapper.
+func Maybe(err error, code int) error {
+	if code == 0 {
+		return err
+	}
+	stack := make([]uintptr, 32)
+	n := runtime.Callers(2, stack)
+	return &codeErr{err: err, code: code, stack: stack[:n]}
+}
+
+// Unstacked captures a stack trace, but doesn't keep it.
+func Unstacked(err error, code int) error {
+	stack := make([]uintptr, 32)
+	runtime.Callers(2, stack)
+	return &codeErr{err: err, code: code}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"inference/errs"
+	"io"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+func main() {
+	_ = imported()
+	_ = local()
+	_ = chained()
+	_ = described()
+	_ = coded()
+	_ = maybe()
+}
+
+func imported() error { // want imported:"wrapped"
+	_, err := strconv.Atoi("wrapped")
+	return errs.Internal(err, 500)
+}
+
+func local() error { // want local:"wrapped"
+	_, err := strconv.Atoi("wrapped")
+	return annotate(err)
+}
+
+func chained() error { // want chained:"wrapped"
+	_, err := strconv.Atoi("wrapped")
+	return annotateTwice(err)
+}
+
+func described() error { // want described:"naked"
+	_, err := strconv.Atoi("naked")
+	return describe(err)
+}
+
+func coded() error { // want coded:"naked"
+	_, err := strconv.Atoi("naked")
+	return errs.Code(err, 400) // want `error returned from external package is not wrapped`
+}
+
+func annotate(err error) error { // want annotate:"inferred wrapper" annotate:"wrapped"
+	return errors.WithStack(err)
+}
+
+// annotateTwice is inferred once annotate is.
+func annotateTwice(err error) error { // want annotateTwice:"inferred wrapper" annotateTwice:"wrapped"
+	if err == nil {
+		return nil
+	}
+	return annotate(err)
+}
+
+// describe doesn't capture a stack trace.
+func describe(err error) error { // want describe:"naked"
+	return fmt.Errorf("describe: %w", err) // want `error returned from external package is not wrapped`
+}
+
+// eof wraps an error, but not its argument.
+func eof(err error) error { // want eof:"wrapped"
+	return errors.WithStack(io.EOF)
+}
+
+func maybe() error { // want maybe:"naked"
+	_, err := strconv.Atoi("naked")
+	return errs.Maybe(err, 0) // want `error returned from external package is not wrapped`
+}
@@ -0,0 +1,17 @@
+package lib
+
+import (
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+func Wrapped() error {
+	_, err := strconv.Atoi("wrapped")
+	return errors.WithStack(err)
+}
+
+func Naked() error {
+	_, err := strconv.Atoi("naked")
+	return err
+}
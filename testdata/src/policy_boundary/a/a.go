@@ -0,0 +1,21 @@
+package a
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func Exported() error { // want Exported:"naked"
+	return fmt.Errorf("exported") // want `error returned from external package is not wrapped \(wrap-at-boundary: Exported can be called from other packages and must return wrapped errors\)`
+}
+
+func unexported() error { // want unexported:"naked"
+	return fmt.Errorf("unexported")
+}
+
+type T struct{}
+
+func (T) Method() error { // want Method:"naked"
+	_, err := strconv.Atoi("method")
+	return err // want `error returned from external package is not wrapped \(wrap-at-boundary: Method can be called from other packages and must return wrapped errors\)`
+}
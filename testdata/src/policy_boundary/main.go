@@ -0,0 +1,8 @@
+package main
+
+import "policy_boundary/a"
+
+func main() {
+	a.Exported()
+	a.T{}.Method()
+}
@@ -0,0 +1,7 @@
+package a
+
+import "fmt"
+
+func Exported() error { // want Exported:"naked"
+	return fmt.Errorf("exported")
+}
@@ -0,0 +1,11 @@
+package store
+
+import "fmt"
+
+func Get() error { // want Get:"naked"
+	return fmt.Errorf("get") // want `error returned from external package is not wrapped \(wrap-at-exported-api: Get is exported by the internal package policy_exported/internal/store and must return wrapped errors\)`
+}
+
+func get() error { // want get:"naked"
+	return fmt.Errorf("get")
+}
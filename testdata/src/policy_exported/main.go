@@ -0,0 +1,11 @@
+package main
+
+import (
+	"policy_exported/a"
+	"policy_exported/internal/store"
+)
+
+func main() {
+	a.Exported()
+	store.Get()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"redundant_wrap/a"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	pkgerrors "github.com/pkg/errors"
+)
+
+func main() {
+	stack()
+	message()
+	formatted(1)
+	annotated()
+	annotatedNaked()
+	naked()
+	foreign()
+}
+
+func stack() error { // want stack:"wrapped"
+	err := a.A()
+	if err != nil {
+		return errors.WithStack(err) // want `error passed to WithStack is already wrapped`
+	}
+	return nil
+}
+
+func message() error { // want message:"wrapped"
+	err := a.A()
+	if err != nil {
+		return errors.Wrap(err, "message") // want `error passed to Wrap is already wrapped`
+	}
+	return nil
+}
+
+func naked() error { // want naked:"wrapped"
+	_, err := strconv.Atoi("naked")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func formatted(n int) error { // want formatted:"wrapped"
+	err := a.A()
+	if err != nil {
+		return errors.Wrapf(err, "message %d", n) // want `error passed to Wrapf is already wrapped`
+	}
+	return nil
+}
+
+// annotated already uses the message wrapper, which keeps the error wrapped.
+func annotated() error { // want annotated:"wrapped"
+	err := a.A()
+	if err != nil {
+		return errors.WithMessage(err, "message")
+	}
+	return nil
+}
+
+// annotatedNaked annotates a naked error, which stays naked.
+func annotatedNaked() error { // want annotatedNaked:"naked"
+	_, err := strconv.Atoi("naked")
+	return errors.WithMessage(err, "message") // want `error returned from external package is not wrapped`
+}
+
+// foreign wraps with a package without a message wrapper, so removing the
+// call would drop its message.
+func foreign() error { // want foreign:"wrapped"
+	err := a.A()
+	if err != nil {
+		return pkgerrors.Wrap(err, "message") // want `error passed to Wrap is already wrapped`
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+var ErrFoo = errors.New("foo")
+
+func main() {
+	_ = external()
+	_ = compare()
+}
+
+// The external rule is disabled, the function is still naked.
+func external() error { // want external:"naked"
+	_, err := strconv.Atoi("naked")
+	return err
+}
+
+// The comparison rule is enabled on its own, leaving type assertions out.
+func compare() error { // want compare:"wrapped"
+	err := external()
+	if err == ErrFoo {
+		return nil
+	}
+	wrapped := errors.WithStack(err)
+	if wrapped == ErrFoo { // want `comparison of error wrapped with == may fail on wrapped errors, use errors.Is`
+		return nil
+	}
+	if _, ok := wrapped.(interface{ Cause() error }); ok {
+		return nil
+	}
+	return wrapped
+}
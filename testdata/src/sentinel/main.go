@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/cockroachdb/errors"
+)
+
+var ErrNotFound = errors.New("not found")
+
+func main() {
+	eof()
+	canceled()
+	noRows()
+	notFound()
+}
+
+func eof() error { // want eof:"wrapped"
+	return io.EOF
+}
+
+func canceled() error { // want canceled:"naked"
+	return context.Canceled // want `sentinel error context.Canceled is returned without being wrapped`
+}
+
+func noRows() error { // want noRows:"wrapped"
+	return errors.WithStack(sql.ErrNoRows) // want `sentinel error database/sql.ErrNoRows must not be wrapped`
+}
+
+func notFound() error { // want notFound:"wrapped"
+	return ErrNotFound
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"sink/a"
+	"strconv"
+)
+
+func main() {
+	err := a.Wrapped()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = a.Naked()
+	if err != nil {
+		log.Printf("naked: %v", err) // want `error returned from external package is passed to log.Printf without being wrapped`
+	}
+
+	log.Fatal(a.Naked()) // want `error returned from external package is passed to log.Fatal without being wrapped`
+
+	_, err = strconv.Atoi("not a sink")
+	log.Println(err)
+}
+
+type service struct {
+	fn func() error
+}
+
+func (s *service) run() {
+	log.Printf("%v", s.fn())
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	pkgerrors "github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+func main() {
+	_ = stubbed()
+	_ = passthrough()
+	_ = nakedPassthrough()
+	_ = sentinels(0)
+	_ = methodValues(nil)
+	_ = nakedMethodValues(nil)
+}
+
+func stubbed() error { // want stubbed:"wrapped"
+	return pkgerrors.New("wrapped")
+}
+
+func passthrough() error { // want passthrough:"wrapped"
+	_, err := strconv.Atoi("naked")
+	return errors.WithMessage(errors.WithStack(err), "message")
+}
+
+func nakedPassthrough() error { // want nakedPassthrough:"naked"
+	_, err := strconv.Atoi("naked")
+	return errors.WithMessage(err, "message") // want `error returned from external package is not wrapped`
+}
+
+func sentinels(n int) error { // want sentinels:"wrapped"
+	if n == 0 {
+		return io.EOF
+	}
+	return strconv.ErrRange
+}
+
+// methodValues passes a method described by a wrapped stub as a value, which
+// is known through its fact.
+func methodValues(f *os.File) error { // want methodValues:"wrapped"
+	var g errgroup.Group
+	g.Go(f.Sync)
+	return g.Wait()
+}
+
+func nakedMethodValues(f *os.File) error { // want nakedMethodValues:"naked"
+	var g errgroup.Group
+	g.Go(f.Close)
+	return g.Wait() // want `error returned by a function passed to errgroup.Group.Go is not wrapped`
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"mycorp.com/lib"
+)
+
+func main() {
+	_ = wrapped()
+	_ = naked()
+}
+
+func wrapped() error { // want wrapped:"wrapped"
+	return lib.Wrapped()
+}
+
+func naked() error { // want naked:"naked"
+	err := lib.Naked()
+	return err // want `error returned from external package is not wrapped`
+}
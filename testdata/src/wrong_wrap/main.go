@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+)
+
+func main() {
+	wrong()
+	right()
+	literal()
+	checkedNil()
+	unassigned()
+	conjunction(true)
+	nested(true)
+	assigned()
+	ranged(nil)
+	addressed()
+}
+
+func wrong() error { // want wrong:"wrapped"
+	_, err := json.Marshal(struct{}{})
+	_, err2 := strconv.Atoi("wrong")
+	if err2 != nil {
+		return errors.WithStack(err) // want `wrapped error err is not the error checked by the enclosing condition \(err2\)`
+	}
+	return nil
+}
+
+func right() error { // want right:"wrapped"
+	_, err := strconv.Atoi("right")
+	if nil != err {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func literal() error { // want literal:"wrapped"
+	return errors.WithStack(nil) // want `wrapped error is always nil`
+}
+
+func checkedNil() error { // want checkedNil:"wrapped"
+	_, err := strconv.Atoi("nil")
+	if err == nil {
+		return errors.WithStack(err) // want `wrapped error is always nil`
+	}
+	return nil
+}
+
+func unassigned() error { // want unassigned:"wrapped"
+	var err error
+	return errors.WithStack(err) // want `wrapped error is always nil`
+}
+
+func conjunction(verbose bool) error { // want conjunction:"wrapped"
+	_, err := json.Marshal(struct{}{})
+	_, err2 := strconv.Atoi("conjunction")
+	if verbose && err != nil {
+		return errors.WithStack(err)
+	}
+	if err2 != nil && verbose {
+		return errors.WithStack(err) // want `wrapped error err is not the error checked by the enclosing condition \(err2\)`
+	}
+	return nil
+}
+
+func nested(retry bool) error { // want nested:"wrapped"
+	_, err := json.Marshal(struct{}{})
+	_, err2 := strconv.Atoi("nested")
+	if err != nil {
+		// Only the innermost condition is considered.
+		if retry {
+			return errors.WithStack(err2)
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func assigned() error { // want assigned:"wrapped"
+	_, err := json.Marshal(struct{}{})
+	_, err2 := strconv.Atoi("assigned")
+	if err2 != nil {
+		wrapped := errors.WithStack(err) // want `wrapped error err is not the error checked by the enclosing condition \(err2\)`
+		return wrapped
+	}
+	return nil
+}
+
+func ranged(errs []error) error { // want ranged:"wrapped"
+	var err error
+	for _, err = range errs {
+		if err != nil {
+			break
+		}
+	}
+	return errors.WithStack(err)
+}
+
+func addressed() error { // want addressed:"wrapped"
+	var err error
+	parse(&err)
+	return errors.WithStack(err)
+}
+
+func parse(err *error) {
+	_, *err = strconv.Atoi("addressed")
+}
@@ -0,0 +1,148 @@
+package errcheckstack
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// checkWrappedArg reports calls to a wrapping function whose error argument
+// cannot be the error the surrounding code meant to wrap: either it isn't the
+// error checked by the nearest enclosing `if err != nil`, or it is provably nil.
+//
+// In both cases, the call passes the wrapping check while returning the wrong,
+// and often nil, error.
+func checkWrappedArg(cfg *Config, pass *analysis.Pass, file *ast.File, call *ast.CallExpr) {
+	fn := extractFunc(pass.TypesInfo, call.Fun)
+	if fn == nil || !isWrapper(cfg, pass, fn) {
+		return
+	}
+
+	var arg ast.Expr
+	for _, a := range call.Args {
+		if isError(pass.TypesInfo.TypeOf(a)) || pass.TypesInfo.Types[a].IsNil() {
+			arg = astutil.Unparen(a)
+			break
+		}
+	}
+	if arg == nil {
+		return
+	}
+
+	if pass.TypesInfo.Types[arg].IsNil() {
+		reportf(cfg, pass, RuleNilWrap, arg.Pos(), "wrapped error is always nil")
+		return
+	}
+
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		// Only variables can be compared against the error being checked.
+		return
+	}
+	obj := pass.TypesInfo.ObjectOf(ident)
+	if obj == nil {
+		return
+	}
+
+	path, _ := astutil.PathEnclosingInterval(file, call.Pos(), call.End())
+PATH:
+	for i, n := range path {
+		switch n := n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			// Conditions outside of the current function are not relevant.
+			break PATH
+		case *ast.IfStmt:
+			// Only the innermost condition is considered, and only when it guards
+			// the branch the call is in.
+			if i == 0 || path[i-1] != n.Body {
+				return
+			}
+			nonNil, isNil := nilChecks(pass, n.Cond)
+			for _, checked := range isNil {
+				if pass.TypesInfo.ObjectOf(checked) == obj {
+					reportf(cfg, pass, RuleNilWrap, arg.Pos(), "wrapped error is always nil")
+					return
+				}
+			}
+			if len(nonNil) == 0 {
+				return
+			}
+			var names []string
+			for _, checked := range nonNil {
+				if pass.TypesInfo.ObjectOf(checked) == obj {
+					return
+				}
+				names = append(names, checked.Name)
+			}
+			reportf(cfg, pass, RuleWrongWrap, arg.Pos(), "wrapped error %s is not the error checked by the enclosing condition (%s)", ident.Name, strings.Join(names, ", "))
+			return
+		}
+	}
+
+	// Outside of any nil check, a variable that is declared but never assigned is nil.
+	if isNeverAssigned(pass, ident) {
+		reportf(cfg, pass, RuleNilWrap, arg.Pos(), "wrapped error is always nil")
+	}
+}
+
+// nilChecks returns the error identifiers that cond compares against nil,
+// either as a whole or as one of the operands of &&, split between the ones
+// that are non-nil and nil when cond holds.
+func nilChecks(pass *analysis.Pass, cond ast.Expr) (nonNil, isNil []*ast.Ident) {
+	if bin, ok := astutil.Unparen(cond).(*ast.BinaryExpr); ok && bin.Op == token.LAND {
+		xNonNil, xIsNil := nilChecks(pass, bin.X)
+		yNonNil, yIsNil := nilChecks(pass, bin.Y)
+		return append(xNonNil, yNonNil...), append(xIsNil, yIsNil...)
+	}
+	switch checked, op := nilCheck(pass, cond); op {
+	case token.NEQ:
+		nonNil = append(nonNil, checked)
+	case token.EQL:
+		isNil = append(isNil, checked)
+	}
+	return nonNil, isNil
+}
+
+// nilCheck returns the error identifier compared against nil by cond, along
+// with the comparison operator. It returns nil if cond isn't such a comparison.
+func nilCheck(pass *analysis.Pass, cond ast.Expr) (*ast.Ident, token.Token) {
+	bin, ok := astutil.Unparen(cond).(*ast.BinaryExpr)
+	if !ok || (bin.Op != token.NEQ && bin.Op != token.EQL) {
+		return nil, token.ILLEGAL
+	}
+
+	x, y := astutil.Unparen(bin.X), astutil.Unparen(bin.Y)
+	if pass.TypesInfo.Types[x].IsNil() {
+		x, y = y, x
+	}
+	if !pass.TypesInfo.Types[y].IsNil() {
+		return nil, token.ILLEGAL
+	}
+
+	ident, ok := x.(*ast.Ident)
+	if !ok || !isError(pass.TypesInfo.TypeOf(ident)) {
+		return nil, token.ILLEGAL
+	}
+	return ident, bin.Op
+}
+
+// isNeverAssigned returns whether ident refers to a variable declared with
+// `var` without any value, and which is never assigned afterwards, neither by
+// a range clause nor through its address.
+func isNeverAssigned(pass *analysis.Pass, ident *ast.Ident) bool {
+	v, ok := pass.TypesInfo.ObjectOf(ident).(*types.Var)
+	if !ok || ident.Obj == nil || v.Parent() == pass.Pkg.Scope() {
+		// Package level variables may be assigned anywhere in the package.
+		return false
+	}
+	vSpec, ok := ident.Obj.Decl.(*ast.ValueSpec)
+	if !ok || len(vSpec.Values) > 0 {
+		return false
+	}
+	assigns := pass.ResultOf[assignsAnalyzer].(*assignIndex)
+	return len(assigns.assignments(ident)) == 0 && !assigns.isAssignedIndirectly(ident)
+}